@@ -0,0 +1,338 @@
+package replica
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheTempPrefix starts names of cache files being written
+const cacheTempPrefix = "tmp-"
+
+// Cache makes Get keep content of files on disk in dir and serve it from
+// there while the file does not change. Cached content is revalidated
+// before every use with a conditional GET, or with a HEAD request comparing
+// modification time and size when the server reports no ETag. Least
+// recently used files are evicted to keep the total under maxBytes, zero or
+// negative maxBytes does not limit it. Files created, updated or removed
+// through the client are dropped from the cache.
+func Cache(dir string, maxBytes int64) func(*Client) {
+	return func(c *Client) {
+		c.cache = &cache{dir: dir, max: maxBytes}
+	}
+}
+
+// cacheEntry describes a cached file, it is stored next to the content
+type cacheEntry struct {
+	Path    string    `json:"path"`
+	ETag    string    `json:"etag,omitempty"`
+	ModTime time.Time `json:"mod_time"`
+	Length  int64     `json:"length"` // size of the file on the server
+	Size    int64     `json:"size"`   // size of cached content
+
+	key  string // name of content file in cache directory
+	elem *list.Element
+}
+
+// valid reports whether e is content of file fi
+func (e *cacheEntry) valid(fi *FileInfo) bool {
+	return e.ETag == fi.ETag() && e.Length == fi.Size && e.ModTime.Equal(fi.ModTime)
+}
+
+// cache is an LRU cache of file content on disk
+type cache struct {
+	dir string
+	max int64
+
+	once sync.Once
+	err  error // of loading the cache directory
+
+	mu      sync.Mutex // guards fields below
+	entries map[string]*cacheEntry
+	lru     *list.List // of entries, most recently used first
+	size    int64
+}
+
+// cacheKey returns name of cached content of remote file name
+func cacheKey(name string) string {
+	sum := sha256.Sum256([]byte(cachePath(name)))
+	return hex.EncodeToString(sum[:16])
+}
+
+func cachePath(name string) string {
+	return path.Clean("/" + name)
+}
+
+// load reads entries stored in cache directory, it is called once before
+// first use of the cache
+func (c *cache) load() error {
+	c.once.Do(func() {
+		c.entries = make(map[string]*cacheEntry)
+		c.lru = list.New()
+		if c.err = os.MkdirAll(c.dir, 0700); c.err != nil {
+			return
+		}
+		des, err := os.ReadDir(c.dir)
+		if c.err = err; err != nil {
+			return
+		}
+		type used struct {
+			e *cacheEntry
+			t time.Time
+		}
+		var all []used
+		for _, de := range des {
+			name := de.Name()
+			if strings.HasPrefix(name, cacheTempPrefix) {
+				// left by an interrupted fill
+				os.Remove(filepath.Join(c.dir, name))
+				continue
+			}
+			key, ok := strings.CutSuffix(name, ".json")
+			if !ok {
+				continue
+			}
+			e, t, err := c.readEntry(key)
+			if err != nil {
+				os.Remove(filepath.Join(c.dir, name))
+				os.Remove(filepath.Join(c.dir, key))
+				continue
+			}
+			all = append(all, used{e, t})
+		}
+		sort.Slice(all, func(i, j int) bool { return all[i].t.Before(all[j].t) })
+		for _, u := range all {
+			c.add(u.e)
+		}
+	})
+	return c.err
+}
+
+// readEntry reads entry of content file key and time it was last used
+func (c *cache) readEntry(key string) (*cacheEntry, time.Time, error) {
+	meta := filepath.Join(c.dir, key+".json")
+	buf, err := os.ReadFile(meta)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	e := &cacheEntry{key: key}
+	if err = json.Unmarshal(buf, e); err != nil {
+		return nil, time.Time{}, err
+	}
+	mfi, err := os.Stat(meta)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	fi, err := os.Stat(filepath.Join(c.dir, key))
+	if err == nil && (fi.Size() != e.Size || key != cacheKey(e.Path)) {
+		err = errors.New("replica: invalid cache entry")
+	}
+	return e, mfi.ModTime(), err
+}
+
+// add makes e the most recently used entry, replacing entry of the same
+// file and evicting the least recently used ones over the limit
+func (c *cache) add(e *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old := c.entries[e.Path]; old != nil {
+		c.lru.Remove(old.elem)
+		c.size -= old.Size
+	}
+	c.entries[e.Path] = e
+	e.elem = c.lru.PushFront(e)
+	c.size += e.Size
+	for c.max > 0 && c.size > c.max && c.lru.Len() > 1 {
+		c.drop(c.lru.Back().Value.(*cacheEntry))
+	}
+}
+
+// drop removes e and its files, c.mu must be held
+func (c *cache) drop(e *cacheEntry) {
+	if c.entries[e.Path] != e {
+		return
+	}
+	delete(c.entries, e.Path)
+	c.lru.Remove(e.elem)
+	c.size -= e.Size
+	os.Remove(filepath.Join(c.dir, e.key+".json"))
+	os.Remove(filepath.Join(c.dir, e.key))
+}
+
+// lookup returns entry of file name or nil
+func (c *cache) lookup(name string) *cacheEntry {
+	if c.load() != nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[cachePath(name)]
+}
+
+// open returns cached content of e marking it used
+func (c *cache) open(e *cacheEntry) (*os.File, error) {
+	f, err := os.Open(filepath.Join(c.dir, e.key))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.drop(e)
+		return nil, err
+	}
+	if c.entries[e.Path] == e {
+		c.lru.MoveToFront(e.elem)
+		now := time.Now()
+		os.Chtimes(filepath.Join(c.dir, e.key+".json"), now, now)
+	}
+	return f, nil
+}
+
+// remove drops file name from cache, and files under it when all is set
+func (c *cache) remove(name string, all bool) {
+	if c.load() != nil {
+		return
+	}
+	p := cachePath(name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e := c.entries[p]; e != nil {
+		c.drop(e)
+	}
+	if !all {
+		return
+	}
+	for k, e := range c.entries {
+		if strings.HasPrefix(k, strings.TrimSuffix(p, "/")+"/") {
+			c.drop(e)
+		}
+	}
+}
+
+// fill returns reader of body storing it in cache as content of file fi
+// once read completely
+func (c *cache) fill(name string, fi *FileInfo, body io.ReadCloser) io.ReadCloser {
+	if c.load() != nil || c.max > 0 && fi.LogicalSize() > c.max {
+		return body
+	}
+	f, err := os.CreateTemp(c.dir, cacheTempPrefix)
+	if err != nil {
+		return body
+	}
+	e := &cacheEntry{Path: cachePath(name), ETag: fi.ETag(), ModTime: fi.ModTime, Length: fi.Size, key: cacheKey(name)}
+	return &cacheFill{ReadCloser: body, c: c, e: e, f: f}
+}
+
+// cacheFill copies content read from body into cache file
+type cacheFill struct {
+	io.ReadCloser
+	c *cache
+	e *cacheEntry
+	f *os.File // nil once done
+}
+
+func (r *cacheFill) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if r.f == nil {
+		return n, err
+	}
+	if _, werr := r.f.Write(p[:n]); werr != nil {
+		r.abort()
+		return n, err
+	}
+	r.e.Size += int64(n)
+	switch {
+	case r.c.max > 0 && r.e.Size > r.c.max:
+		r.abort()
+	case err == io.EOF:
+		r.commit()
+	case err != nil:
+		r.abort()
+	}
+	return n, err
+}
+
+// commit moves complete content into cache
+func (r *cacheFill) commit() {
+	f := r.f
+	r.f = nil
+	buf, err := json.Marshal(r.e)
+	if err == nil {
+		err = f.Close()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(r.c.dir, r.e.key))
+	}
+	if err == nil {
+		err = os.WriteFile(filepath.Join(r.c.dir, r.e.key+".json"), buf, 0600)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return
+	}
+	r.c.add(r.e)
+}
+
+// abort drops partial content
+func (r *cacheFill) abort() {
+	r.f.Close()
+	os.Remove(r.f.Name())
+	r.f = nil
+}
+
+func (r *cacheFill) Close() error {
+	if r.f != nil {
+		r.abort()
+	}
+	return r.ReadCloser.Close()
+}
+
+// invalidate drops file name from cache of the client if any, and files
+// under it when all is set
+func (c *Client) invalidate(name string, all bool) {
+	if c.cache != nil {
+		c.cache.remove(name, all)
+	}
+}
+
+// getCached is GetContext serving files from cache while they did not
+// change, and storing them in cache otherwise
+func (c *Client) getCached(ctx context.Context, name string) (io.ReadCloser, Files, error) {
+	var p Preconditions
+	e := c.cache.lookup(name)
+	if e != nil && e.ETag != "" {
+		p.IfNoneMatch = e.ETag
+	} else if e != nil {
+		fi, err := c.GetInfoContext(ctx, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if e.valid(fi) {
+			if f, err := c.cache.open(e); err == nil {
+				return f, nil, nil
+			}
+		}
+	}
+	resp, body, fls, err := c.get(ctx, name, p)
+	if errors.Is(err, ErrNotModified) && p.IfNoneMatch != "" {
+		if f, err := c.cache.open(e); err == nil {
+			return f, nil, nil
+		}
+		// cached content is gone, get the file again
+		resp, body, fls, err = c.get(ctx, name, Preconditions{})
+	}
+	if err != nil || body == nil {
+		return nil, fls, err
+	}
+	return c.cache.fill(name, newFileInfo(resp), body), nil, nil
+}
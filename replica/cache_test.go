@@ -0,0 +1,150 @@
+package replica
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// getServer counts HEAD requests and GET requests of files answered with
+// content, it can hide ETags
+type getServer struct {
+	h      http.Handler
+	noETag bool
+	mu     sync.Mutex
+	gets   int
+	heads  int
+}
+
+func (s *getServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	gw := &getWriter{ResponseWriter: w, s: s, count: r.Method == "GET" && r.URL.Path != "/token"}
+	if r.Method == "HEAD" {
+		s.mu.Lock()
+		s.heads++
+		s.mu.Unlock()
+	}
+	s.h.ServeHTTP(gw, r)
+}
+
+type getWriter struct {
+	http.ResponseWriter
+	s     *getServer
+	count bool
+	wrote bool
+}
+
+func (w *getWriter) WriteHeader(code int) {
+	if w.s.noETag {
+		w.Header().Del("ETag")
+	}
+	if w.count && code == http.StatusOK {
+		w.s.mu.Lock()
+		w.s.gets++
+		w.s.mu.Unlock()
+	}
+	w.wrote = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *getWriter) Write(p []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func newCacheClient(t *testing.T, noETag bool, dir string, max int64) (*Client, *Client, *getServer) {
+	other, srv := newTestClient(t)
+	gs := &getServer{h: srv, noETag: noETag}
+	ts := httptest.NewServer(gs)
+	t.Cleanup(ts.Close)
+	clt, err := NewClient(ts.URL, AssignCredentials("test", "secret"), Cache(dir, max))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clt, other, gs
+}
+
+func TestCache(t *testing.T) {
+	for _, noETag := range []bool{false, true} {
+		dir := t.TempDir()
+		clt, other, gs := newCacheClient(t, noETag, dir, 0)
+		data := randomData(1000)
+		if err := clt.CreateFile("public/f", &FileInfo{Size: 1000}, bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			if buf := readAll(t, clt, "public/f"); !bytes.Equal(buf, data) {
+				t.Fatalf("noETag %v: content differs", noETag)
+			}
+		}
+		if gs.gets != 1 {
+			t.Errorf("noETag %v: expected single download, got %d", noETag, gs.gets)
+		}
+		if noETag && gs.heads != 2 {
+			t.Errorf("expected revalidation by HEAD, got %d", gs.heads)
+		}
+
+		// change by another client is seen
+		if err := other.CreateFile("public/f", &FileInfo{Size: 7}, strings.NewReader("changed")); err != nil {
+			t.Fatal(err)
+		}
+		if buf := readAll(t, clt, "public/f"); string(buf) != "changed" {
+			t.Errorf("noETag %v: expected changed, got %q", noETag, buf)
+		}
+		if gs.gets != 2 {
+			t.Errorf("noETag %v: expected download of changed file, got %d", noETag, gs.gets)
+		}
+
+		// cache outlives the client
+		clt2, err := NewClient(clt.Address(), AssignCredentials("test", "secret"), Cache(dir, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf := readAll(t, clt2, "public/f"); string(buf) != "changed" || gs.gets != 2 {
+			t.Errorf("noETag %v: expected cached content, got %q after %d downloads", noETag, buf, gs.gets)
+		}
+
+		// local changes invalidate
+		if err := clt.Update("public/f", map[string]string{"Color": "red"}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if clt.cache.lookup("public/f") != nil {
+			t.Errorf("noETag %v: expected entry dropped by Update", noETag)
+		}
+		readAll(t, clt, "public/f")
+		if err := clt.RemoveAll("public"); err != nil || clt.cache.lookup("public/f") != nil {
+			t.Errorf("noETag %v: expected entry dropped by RemoveAll, got %v", noETag, err)
+		}
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	clt, _, gs := newCacheClient(t, false, t.TempDir(), 2500)
+	for _, name := range []string{"a", "b", "c", "big"} {
+		size := 1000
+		if name == "big" {
+			size = 3000
+		}
+		if err := clt.CreateFile("public/"+name, &FileInfo{Size: int64(size)}, bytes.NewReader(randomData(size))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"a", "b", "a", "c", "big"} {
+		readAll(t, clt, "public/"+name)
+	}
+	for name, cached := range map[string]bool{"a": true, "b": false, "c": true, "big": false} {
+		if e := clt.cache.lookup("public/" + name); (e != nil) != cached {
+			t.Errorf("%s: expected cached %v", name, cached)
+		}
+	}
+	if clt.cache.size != 2000 {
+		t.Errorf("expected cache size 2000, got %d", clt.cache.size)
+	}
+	if gs.gets != 4 {
+		t.Errorf("expected 4 downloads, got %d", gs.gets)
+	}
+}
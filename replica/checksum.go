@@ -0,0 +1,126 @@
+package replica
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// ChecksumMeta is metadata key checksum of file content is stored under,
+// its value is algorithm and hex digest separated by colon
+const ChecksumMeta = "Checksum"
+
+// ChecksumAlgorithm is a hash algorithm of content checksum
+type ChecksumAlgorithm string
+
+// Supported checksum algorithms
+const (
+	ChecksumMD5    ChecksumAlgorithm = "md5"
+	ChecksumSHA256 ChecksumAlgorithm = "sha256"
+)
+
+func (a ChecksumAlgorithm) new() hash.Hash {
+	switch a {
+	case ChecksumMD5:
+		return md5.New()
+	case ChecksumSHA256:
+		return sha256.New()
+	}
+	return nil
+}
+
+// ErrChecksumMismatch is returned at the end of content which does not
+// match its stored checksum, actual error is a *ChecksumError
+var ErrChecksumMismatch = errors.New("replica: checksum mismatch")
+
+// ChecksumError describes content not matching its stored checksum
+type ChecksumError struct {
+	Path     string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%s: checksum mismatch: expected %s, got %s", e.Path, e.Expected, e.Actual)
+}
+
+// Is makes ChecksumError match ErrChecksumMismatch
+func (e *ChecksumError) Is(target error) bool { return target == ErrChecksumMismatch }
+
+// Checksum makes client compute checksum of uploaded files with alg and
+// store it as ChecksumMeta metadata, files having the metadata are verified
+// on download whether set or not
+func Checksum(alg ChecksumAlgorithm) func(*Client) {
+	return func(c *Client) {
+		c.checksum = alg
+	}
+}
+
+// Checksum returns checksum stored in metadata of f or empty string
+func (f *FileInfo) Checksum() string { return f.metaData[ChecksumMeta] }
+
+// formatChecksum returns checksum value of h computed with alg
+func formatChecksum(alg ChecksumAlgorithm, h hash.Hash) string {
+	return string(alg) + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// sumSeeker returns checksum of rest of r, leaving r at current offset
+func sumSeeker(alg ChecksumAlgorithm, r io.ReadSeeker) (string, error) {
+	off, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", err
+	}
+	h := alg.new()
+	if _, err = io.Copy(h, r); err != nil {
+		return "", err
+	}
+	if _, err = r.Seek(off, io.SeekStart); err != nil {
+		return "", err
+	}
+	return formatChecksum(alg, h), nil
+}
+
+// newVerifier returns reader of r failing at EOF when r does not match
+// checksum sum, r is returned as is when algorithm of sum is unknown
+func newVerifier(r io.ReadCloser, name, sum string) io.ReadCloser {
+	alg, _, _ := strings.Cut(sum, ":")
+	h := ChecksumAlgorithm(alg).new()
+	if h == nil {
+		return r
+	}
+	return &verifier{ReadCloser: r, name: name, sum: sum, alg: ChecksumAlgorithm(alg), h: h}
+}
+
+type verifier struct {
+	io.ReadCloser
+	name string
+	sum  string
+	alg  ChecksumAlgorithm
+	h    hash.Hash
+}
+
+func (v *verifier) Read(p []byte) (int, error) {
+	n, err := v.ReadCloser.Read(p)
+	v.h.Write(p[:n])
+	if err == io.EOF {
+		if sum := formatChecksum(v.alg, v.h); sum != v.sum {
+			return n, &ChecksumError{Path: v.name, Expected: v.sum, Actual: sum}
+		}
+	}
+	return n, err
+}
+
+// verifyFile checks content of file r read from start matches checksum
+// sum of remote file name
+func verifyFile(r io.ReadSeeker, name, sum string) error {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.Copy(io.Discard, newVerifier(io.NopCloser(r), name, sum))
+	return err
+}
@@ -0,0 +1,91 @@
+package replica
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	clt, _ := newTestClient(t, Checksum(ChecksumSHA256))
+	data := randomData(3000)
+	if err := clt.CreateFile("public/seek", &FileInfo{Size: 3000}, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	fi, err := clt.GetInfo("public/seek")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "sha256:" + hex.EncodeToString(sum[:]); fi.Checksum() != want {
+		t.Errorf("expected checksum %s, got %s", want, fi.Checksum())
+	}
+
+	// streamed body gets its checksum after upload
+	clt.checksum = ChecksumMD5
+	r := struct{ io.Reader }{bytes.NewReader(data)}
+	if err := clt.CreateFile("public/stream", &FileInfo{Size: 3000}, r); err != nil {
+		t.Fatal(err)
+	}
+	msum := md5.Sum(data)
+	if fi, err = clt.GetInfo("public/stream"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "md5:" + hex.EncodeToString(msum[:]); fi.Checksum() != want {
+		t.Errorf("expected checksum %s, got %s", want, fi.Checksum())
+	}
+
+	for _, name := range []string{"public/seek", "public/stream"} {
+		rc, _, err := clt.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if !bytes.Equal(buf, data) {
+			t.Errorf("%s: content differs", name)
+		}
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	clt, _ := newTestClient(t, Checksum(ChecksumSHA256))
+	data := randomData(3000)
+	if err := clt.CreateFile("public/f", &FileInfo{Size: 3000}, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	bad := "sha256:" + hex.EncodeToString(make([]byte, sha256.Size))
+	if err := clt.Update("public/f", map[string]string{ChecksumMeta: bad}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, _, err := clt.Get("public/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(rc)
+	rc.Close()
+	var cerr *ChecksumError
+	if !errors.Is(err, ErrChecksumMismatch) || !errors.As(err, &cerr) || cerr.Expected != bad {
+		t.Errorf("expected checksum error, got %v", err)
+	}
+
+	local := filepath.Join(t.TempDir(), "f")
+	if _, err = clt.DownloadFile("public/f", local, nil); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected checksum error, got %v", err)
+	}
+	for _, p := range []string{local, local + PartSuffix} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("expected %s not to exist, got %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// ManifestContentType is content type of the manifest stored in place of
+	// a file uploaded in chunks
+	ManifestContentType = "application/vnd.replica.manifest+json"
+	// ChunksSuffix is appended to name of a file uploaded in chunks to name
+	// the directory holding its chunks
+	ChunksSuffix = ".chunks"
+)
+
+// manifest lists chunks a file uploaded in chunks is reassembled from
+type manifest struct {
+	Size        int64    `json:"size"`
+	ChunkSize   int64    `json:"chunk_size"`
+	ContentType string   `json:"content_type,omitempty"`
+	Chunks      []string `json:"chunks"`
+}
+
+// chunked reports whether f is a manifest of a file uploaded in chunks
+func (f *FileInfo) chunked() bool { return f.contentType == ManifestContentType }
+
+// hideChunks drops from files directories holding chunks of files listed
+// next to them, listings do not tell manifests from other files so any file
+// named like the directory without ChunksSuffix counts
+func hideChunks(files Files) Files {
+	names := make(map[string]bool, len(files))
+	for _, fi := range files {
+		if !fi.IsDir {
+			names[fi.Name] = true
+		}
+	}
+	kept := files[:0]
+	for _, fi := range files {
+		if base, ok := strings.CutSuffix(fi.Name, ChunksSuffix); ok && fi.IsDir && names[base] {
+			continue
+		}
+		kept = append(kept, fi)
+	}
+	return kept
+}
+
+// chunkLen returns length of chunk i
+func (m *manifest) chunkLen(i int) int64 {
+	if rest := m.Size - int64(i)*m.ChunkSize; rest < m.ChunkSize {
+		return rest
+	}
+	return m.ChunkSize
+}
+
+// decodeManifest reads manifest from r and checks it is consistent
+func decodeManifest(r io.Reader) (*manifest, error) {
+	m := &manifest{}
+	if err := json.NewDecoder(r).Decode(m); err != nil {
+		return nil, err
+	}
+	if m.Size < 0 || m.ChunkSize <= 0 || int64(len(m.Chunks)) != (m.Size+m.ChunkSize-1)/m.ChunkSize {
+		return nil, fmt.Errorf("invalid manifest of %d chunks for %d bytes", len(m.Chunks), m.Size)
+	}
+	return m, nil
+}
+
+// getManifest fetches manifest of file name uploaded in chunks
+func (c *Client) getManifest(ctx context.Context, name string) (*manifest, error) {
+	_, body, err := c.getBody(ctx, name, Preconditions{})
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return decodeManifest(body)
+}
+
+// readChunks returns reader of content reassembled from chunks of m
+// starting at offset off
+func (c *Client) readChunks(ctx context.Context, m *manifest, off int64) io.ReadCloser {
+	return &chunkReader{c: c, ctx: ctx, m: m, off: off}
+}
+
+// openChunk returns reader of chunk name starting at off, chunks are read
+// whole as they may be stored encrypted or compressed
+func (c *Client) openChunk(ctx context.Context, name string, off int64) (io.ReadCloser, error) {
+	_, body, err := c.getBody(ctx, name, Preconditions{})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.CopyN(io.Discard, body, off); err != nil {
+		body.Close()
+		return nil, err
+	}
+	return body, nil
+}
+
+type chunkReader struct {
+	c   *Client
+	ctx context.Context
+	m   *manifest
+	off int64
+	rc  io.ReadCloser // current chunk
+	end int64         // offset current chunk ends at
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.rc == nil {
+			if r.off >= r.m.Size {
+				return 0, io.EOF
+			}
+			i := int(r.off / r.m.ChunkSize)
+			rel := r.off - int64(i)*r.m.ChunkSize
+			rc, err := r.c.openChunk(r.ctx, r.m.Chunks[i], rel)
+			if err != nil {
+				return 0, err
+			}
+			r.rc, r.end = rc, int64(i)*r.m.ChunkSize+r.m.chunkLen(i)
+		}
+		n, err := r.rc.Read(p)
+		r.off += int64(n)
+		if r.off > r.end {
+			return 0, fmt.Errorf("chunk %d longer than expected", (r.end-1)/r.m.ChunkSize)
+		}
+		if err != io.EOF {
+			return n, err
+		}
+		r.rc.Close()
+		r.rc = nil
+		if r.off < r.end {
+			return n, io.ErrUnexpectedEOF
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.rc == nil {
+		return nil
+	}
+	err := r.rc.Close()
+	r.rc = nil
+	return err
+}
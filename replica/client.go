@@ -1,32 +1,102 @@
 package replica
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"io"
 	"io/ioutil"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Client for replica server
 type Client struct {
-	addr        string
-	token       *Token
-	unsecureSSL bool
-	useSSL      bool
-	httpClient  *http.Client
+	addr          string
+	token         *Token
+	unsecureSSL   bool
+	tls           *tls.Config // set by TLS options
+	useSSL        bool
+	httpClient    *http.Client
+	transport     http.RoundTripper // replaces transport of httpClient
+	middleware    []Middleware
+	stats         metrics
+	logger        *slog.Logger // logs requests when set
+	logLevel      slog.Level
+	creds         CredentialsFunc
+	retry         *RetryPolicy
+	listing       int               // directories listed at once by Walk
+	readAhead     int               // read-ahead buffer size of File
+	limit         Limiter           // bandwidth limit of all requests
+	checksum      ChecksumAlgorithm // algorithm of upload checksums
+	keys          KeyProvider       // encrypts files when set
+	compression   Encoding
+	compressTypes []string  // content types compressed, all when empty
+	cache         *cache    // of file content, nil when disabled
+	once          sync.Once // initializes httpClient
+
+	mu   sync.Mutex    // guards token and skew
+	skew time.Duration // server clock minus local clock
+
+	epMu        sync.Mutex // guards endpoints state
+	endpoints   []*endpoint
+	maxFailures int
+	coolOff     time.Duration
+
+	err error // of options, returned by NewClient
 }
 
 // NewClient return a new instance of Client type
 func NewClient(addr string, opts ...func(*Client)) (*Client, error) {
+	return NewMultiClient([]string{addr}, opts...)
+}
+
+// NewMultiClient return a new instance of Client type sending requests to
+// the first healthy of addrs and failing over to the others
+func NewMultiClient(addrs []string, opts ...func(*Client)) (*Client, error) {
+	if len(addrs) == 0 {
+		addrs = []string{""}
+	}
+	client := &Client{
+		token:       new(Token),
+		maxFailures: defaultMaxFailures,
+		coolOff:     defaultCoolOff,
+	}
+	for _, addr := range addrs {
+		e, err := newEndpoint(addr)
+		if err != nil {
+			return nil, err
+		}
+		client.endpoints = append(client.endpoints, e)
+		client.useSSL = client.useSSL || e.url.Scheme == "https"
+	}
+	client.addr = client.endpoints[0].addr
+
+	for _, opt := range opts {
+		opt(client)
+	}
+	if client.err != nil {
+		return nil, client.err
+	}
+
+	return client, nil
+}
+
+// normalizeAddr completes addr with default scheme, port and json path
+func normalizeAddr(addr string) (string, error) {
 	if addr == "" {
 		addr = "localhost"
 	}
 	addr = strings.TrimSuffix(addr, "/")
 	u, err := url.Parse(addr)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 	if u.Scheme != "http" && u.Scheme != "https" {
 		addr = "http://" + addr
@@ -39,17 +109,7 @@ func NewClient(addr string, opts ...func(*Client)) (*Client, error) {
 	if !strings.HasSuffix(addr, "/json") {
 		addr += "/json"
 	}
-	client := &Client{
-		addr:   addr,
-		useSSL: u.Scheme == "https",
-		token:  new(Token),
-	}
-
-	for _, opt := range opts {
-		opt(client)
-	}
-
-	return client, nil
+	return addr, nil
 }
 
 // Address returns client connection address
@@ -70,24 +130,160 @@ func AssignToken(token string) func(*Client) {
 }
 
 func (c *Client) do(req *http.Request) (*http.Response, error) {
-	if c.httpClient == nil {
-		if c.useSSL {
-			tr := &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: c.unsecureSSL},
-			}
-			c.httpClient = &http.Client{Transport: tr}
-		} else {
-			c.httpClient = &http.Client{}
+	if b, ok := req.Body.(*seekBody); ok {
+		defer b.rw.close()
+	}
+	tk, err := c.authToken(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	if tk != "" {
+		req.Header.Set("X-Auth-Token", tk)
+	}
+	resp, err := c.send(req)
+	if errors.Is(err, ErrUnauthorized) && c.creds != nil && (req.Body == nil || req.GetBody != nil) {
+		// token was rejected, authenticate again and retry once
+		if tk, err = c.refreshToken(req.Context(), tk); err != nil {
+			return nil, err
+		}
+		if req, err = rewind(req); err != nil {
+			return nil, err
 		}
+		req.Header.Set("X-Auth-Token", tk)
+		resp, err = c.send(req)
 	}
-	if c.token != nil && c.token.String() != "" {
-		req.Header.Add("X-Auth-Token", c.token.String())
+	if err != nil {
+		return resp, err
+	}
+	resp.Body = c.limitBody(req.Context(), resp.Body)
+	if t := progressFrom(req.Context()); t != nil && req.Method == "GET" &&
+		resp.Header.Get("X-Type") != "dir" && resp.Header.Get("Content-Type") != ManifestContentType {
+		size := resp.ContentLength
+		if size < 0 {
+			size, _ = strconv.ParseInt(resp.Header.Get("X-Length"), 10, 64)
+		}
+		resp.Body = t.wrap(resp.Body, size)
 	}
-	resp, err := c.httpClient.Do(req)
+	return resp, nil
+}
+
+// doClose performs req discarding response body
+func (c *Client) doClose(req *http.Request) error {
+	resp, err := c.do(req)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// send performs req without authentication, failing over to other
+// endpoints and repeating it on transient failures as retry policy allows
+func (c *Client) send(req *http.Request) (resp *http.Response, err error) {
+	op, start, attempts := c.operation(req), time.Now(), 0
+	var sent atomic.Int64
+	defer func() {
+		d := time.Since(start)
+		c.stats.request(op, resp, err, d, attempts-1, sent.Load())
+		if c.logger != nil {
+			c.logRequest(req, resp, err, d, attempts, sent.Load())
+		}
+		if err == nil {
+			resp.Body = &countedBody{ReadCloser: resp.Body, m: &c.stats, op: op}
+		}
+	}()
+	var tried []*endpoint
+	for attempt := 1; ; {
+		e := c.endpoint(tried)
+		attempts++
+		resp, err := c.roundTrip(e, req, &sent)
+		failed := c.report(e, err)
+		if err == nil {
+			return resp, nil
+		}
+		tried = append(tried, e)
+		switch {
+		case failed && len(tried) < len(c.endpoints) && repeatable(req):
+		case c.retry != nil && attempt < c.retry.MaxAttempts && c.retry.retryable(req, err):
+			if err = sleep(req, c.retry.backoff(attempt, resp)); err != nil {
+				return nil, err
+			}
+			attempt++
+			tried = nil
+		default:
+			return resp, err
+		}
+		if req, err = rewind(req); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// client returns http client, creating it on first use
+func (c *Client) client() *http.Client {
+	c.once.Do(func() {
+		hc := &http.Client{}
+		if c.httpClient != nil {
+			// copy, so the caller's client is not changed
+			*hc = *c.httpClient
+		} else if (c.useSSL || c.tls != nil) && c.transport == nil {
+			// keep proxy, HTTP/2 and timeouts of the default transport
+			t := &http.Transport{}
+			if dt, ok := http.DefaultTransport.(*http.Transport); ok {
+				t = dt.Clone()
+			}
+			t.TLSClientConfig = c.tlsConfig()
+			hc.Transport = t
+		}
+		if c.transport != nil {
+			hc.Transport = c.transport
+		}
+		if len(c.middleware) > 0 {
+			rt := hc.Transport
+			if rt == nil {
+				rt = http.DefaultTransport
+			}
+			for i := len(c.middleware) - 1; i >= 0; i-- {
+				rt = c.middleware[i](rt)
+			}
+			hc.Transport = rt
+		}
+		c.httpClient = hc
+	})
+	return c.httpClient
+}
+
+// roundTrip performs a single attempt of req against endpoint e, adding
+// bytes of request body sent to sent
+func (c *Client) roundTrip(e *endpoint, req *http.Request, sent *atomic.Int64) (*http.Response, error) {
+	method, name := req.Method, c.remotePath(req.URL)
+	if e.addr != c.addr {
+		req = req.WithContext(req.Context())
+		req.URL = c.rebase(req.URL, e)
+		req.Host = ""
+	}
+	var body *progressReader
+	if req.Body != nil && req.Body != http.NoBody {
+		req = req.WithContext(req.Context())
+		req.Body = c.limitBody(req.Context(), &sentBody{ReadCloser: req.Body, n: sent})
+		if t := progressFrom(req.Context()); t != nil {
+			body = t.wrap(req.Body, req.ContentLength)
+			req.Body = body
+		}
+	}
+	resp, err := c.client().Do(req)
+	if err == nil {
+		if err = parsResponse(resp); err != nil {
+			herr := err.(*HTTPError)
+			herr.Method, herr.Path = method, name
+			herr.Message = redact(herr.Message, req)
+		}
+	} else if cerr := req.Context().Err(); cerr != nil {
+		err = cerr
+	}
+	if err != nil && body != nil {
+		// failed attempt does not count
+		body.undo()
 	}
-	err = parsResponse(resp)
 	return resp, err
 }
 
@@ -104,16 +300,33 @@ func (c *Client) joinURL(name string) string {
 	return addr + "/" + name
 }
 
-func (c *Client) newRequest(m, p string, r io.Reader) (*http.Request, error) {
-	req, err := http.NewRequest(m, c.joinURL(p), r)
+// remotePath returns resource name of request URL u built by joinURL
+func (c *Client) remotePath(u *url.URL) string {
+	p := strings.TrimPrefix(u.Path, urlRoot(c.addr))
+	return strings.Trim(strings.TrimPrefix(p, "/json"), "/")
+}
+
+func (c *Client) newRequest(ctx context.Context, m, p string, r io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, m, c.joinURL(p), r)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("User-Agent", "Replica Client v0.1")
+	if rs, ok := r.(io.ReadSeeker); ok && req.GetBody == nil {
+		// make body re-readable to allow retries
+		if rw, err := newRewinder(rs); err == nil {
+			req.Body = rw.cur
+			req.GetBody = rw.rewind
+		}
+	}
 	return req, nil
 }
 
 func parsResponse(resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return &HTTPError{Code: resp.StatusCode, Message: "not modified"}
+	}
 	if resp.StatusCode >= 400 {
 		buf, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
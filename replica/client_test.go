@@ -1,10 +1,14 @@
 package replica
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestNewClient(t *testing.T) {
@@ -58,7 +62,7 @@ func TestClientFail(t *testing.T) {
 		t.Error("expected connection error, got <nil>")
 	}
 
-	_, err = clt.newRequest("NA", "%", nil)
+	_, err = clt.newRequest(context.Background(), "NA", "%", nil)
 	if err == nil {
 		t.Error("expected error, got <nil>")
 	}
@@ -114,3 +118,46 @@ func TestParseResponseFail(t *testing.T) {
 		t.Error("expected read error, got <nil>")
 	}
 }
+
+func TestClientContext(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/json/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	mux.HandleFunc("/json/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Type", "file")
+		w.Write([]byte("part"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	clt, _ := NewClient(ts.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := clt.GetInfoContext(ctx, "slow"); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := clt.RemoveContext(ctx, "slow"); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	rc, _, err := clt.GetContext(ctx, "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	buf := make([]byte, 4)
+	if _, err = io.ReadFull(rc, buf); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err = rc.Read(buf); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,206 @@
+package replica
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Metadata keys describing encoded content of a file
+const (
+	EncodingMeta    = "Content-Encoding"
+	LogicalSizeMeta = "Logical-Size"
+)
+
+// Encoding is compression applied to uploaded content
+type Encoding string
+
+// Supported encodings
+const (
+	EncodingIdentity Encoding = ""
+	EncodingGzip     Encoding = "gzip"
+	EncodingDeflate  Encoding = "deflate"
+)
+
+// Compression makes client compress uploaded files of content types
+// types with enc, or files of any type when types are not given. A type
+// ending with "/*" matches all its subtypes. The encoding and size of the
+// content before compression are recorded in metadata, Get decompresses
+// transparently.
+func Compression(enc Encoding, types ...string) func(*Client) {
+	return func(c *Client) {
+		c.compression = enc
+		c.compressTypes = types
+	}
+}
+
+type compressionKey struct{}
+
+// WithCompression returns copy of ctx compressing uploads made with it
+// with enc regardless of client setting, EncodingIdentity disables
+// compression
+func WithCompression(ctx context.Context, enc Encoding) context.Context {
+	return context.WithValue(ctx, compressionKey{}, enc)
+}
+
+// LogicalSize returns size of file content as uploaded, which differs from
+// Size of compressed or encrypted file
+func (f *FileInfo) LogicalSize() int64 {
+	if n, err := strconv.ParseInt(f.metaData[LogicalSizeMeta], 10, 64); err == nil {
+		return n
+	}
+	return f.Size
+}
+
+// compressionFor returns encoding for upload of fi made with ctx
+func (c *Client) compressionFor(ctx context.Context, fi *FileInfo) Encoding {
+	if enc, ok := ctx.Value(compressionKey{}).(Encoding); ok {
+		return enc
+	}
+	if len(c.compressTypes) == 0 {
+		return c.compression
+	}
+	ct, _, _ := strings.Cut(fi.contentType, ";")
+	ct = strings.TrimSpace(ct)
+	for _, t := range c.compressTypes {
+		if t == ct || strings.HasSuffix(t, "/*") && strings.HasPrefix(ct, strings.TrimSuffix(t, "*")) {
+			return c.compression
+		}
+	}
+	return EncodingIdentity
+}
+
+// compress spools fi.Size bytes of r compressed with enc into a temporary
+// file, so the upload has known length and can be repeated. It returns fi
+// with metadata of the encoding and compressed size, and the file which is
+// removed by closing it.
+func compress(enc Encoding, fi *FileInfo, r io.Reader) (*FileInfo, io.ReadSeekCloser, error) {
+	if fi.Size <= 0 {
+		return nil, nil, fmt.Errorf("%w: compressed upload of unknown size", ErrLengthRequired)
+	}
+	tmp, err := os.CreateTemp("", "replica-compress-")
+	if err != nil {
+		return nil, nil, err
+	}
+	f := &tempFile{tmp}
+	var w io.WriteCloser
+	switch enc {
+	case EncodingGzip:
+		w = gzip.NewWriter(f)
+	case EncodingDeflate:
+		w, _ = flate.NewWriter(f, flate.DefaultCompression)
+	default:
+		f.Close()
+		return nil, nil, fmt.Errorf("replica: unsupported encoding %q", enc)
+	}
+	n, err := io.Copy(w, io.LimitReader(r, fi.Size))
+	if err == nil && n < fi.Size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil {
+		err = checkEOF(r)
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	var size int64
+	if err == nil {
+		size, err = f.Seek(0, io.SeekEnd)
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	cfi := *fi
+	cfi.Size = size
+	cfi.metaData = withMeta(fi.metaData, EncodingMeta, string(enc))
+	cfi.metaData = withLogicalSize(cfi.metaData, fi.Size)
+	return &cfi, f, nil
+}
+
+// checkEOF fails unless r has no more content, so content longer than
+// the size it was declared with is not cut silently
+func checkEOF(r io.Reader) error {
+	var b [1]byte
+	switch _, err := io.ReadFull(r, b[:]); err {
+	case io.EOF:
+		return nil
+	case nil:
+		return errors.New("replica: content longer than its size")
+	default:
+		return err
+	}
+}
+
+// withMeta returns copy of meta with key set to v
+func withMeta(meta map[string]string, key, v string) map[string]string {
+	m := make(map[string]string, len(meta)+1)
+	for k, v := range meta {
+		m[k] = v
+	}
+	m[key] = v
+	return m
+}
+
+// withLogicalSize returns meta with LogicalSizeMeta set to size, unless
+// already set by an earlier stage
+func withLogicalSize(meta map[string]string, size int64) map[string]string {
+	if _, ok := meta[LogicalSizeMeta]; ok {
+		return meta
+	}
+	return withMeta(meta, LogicalSizeMeta, strconv.FormatInt(size, 10))
+}
+
+// decompress returns reader decoding r encoded with enc
+func decompress(r io.ReadCloser, enc string) (io.ReadCloser, error) {
+	var zr io.ReadCloser
+	switch Encoding(enc) {
+	case EncodingGzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		zr = gr
+	case EncodingDeflate:
+		zr = flate.NewReader(r)
+	default:
+		return nil, fmt.Errorf("replica: unsupported encoding %q", enc)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{zr, closers{zr, r}}, nil
+}
+
+// closers closes all its members returning the first error
+type closers []io.Closer
+
+func (cs closers) Close() error {
+	var err error
+	for _, c := range cs {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// tempFile is a temporary file removed on close
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
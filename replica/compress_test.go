@@ -0,0 +1,146 @@
+package replica
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func readAll(t *testing.T, clt *Client, name string) []byte {
+	rc, _, err := clt.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	buf, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return buf
+}
+
+func TestCompression(t *testing.T) {
+	data := []byte(strings.Repeat("a compressible line of a log file\n", 3000))
+	for _, enc := range []Encoding{EncodingGzip, EncodingDeflate} {
+		clt, _ := newTestClient(t, Compression(enc), Encryption(testKeys), Checksum(ChecksumMD5))
+		if err := clt.CreateFile("public/log", &FileInfo{Size: int64(len(data))}, bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := clt.GetInfo("public/log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.LogicalSize() != int64(len(data)) || fi.Size >= fi.LogicalSize()/10 {
+			t.Errorf("%s: unexpected sizes %d and %d", enc, fi.Size, fi.LogicalSize())
+		}
+		if fi.MetaData()[EncodingMeta] != string(enc) {
+			t.Errorf("%s: unexpected metadata %v", enc, fi.MetaData())
+		}
+		if buf := readAll(t, clt, "public/log"); !bytes.Equal(buf, data) {
+			t.Errorf("%s: decompressed content differs", enc)
+		}
+
+		local := filepath.Join(t.TempDir(), "log")
+		fi, err = clt.DownloadFile("public/log", local, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf, _ := os.ReadFile(local); !bytes.Equal(buf, data) || fi.Size != int64(len(data)) {
+			t.Errorf("%s: downloaded content differs", enc)
+		}
+		if _, err := clt.Open("public/log"); err == nil {
+			t.Errorf("%s: expected error opening compressed file, got <nil>", enc)
+		}
+	}
+}
+
+func TestCompressionSelection(t *testing.T) {
+	clt, _ := newTestClient(t, Compression(EncodingGzip, "text/*"))
+	dir := t.TempDir()
+	data := strings.Repeat("text ", 1000)
+	writeTree(t, dir, map[string]string{"a.txt": data, "b.bin": data})
+	for _, name := range []string{"a.txt", "b.bin"} {
+		if _, err := clt.UploadFile(filepath.Join(dir, name), "public/"+name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := WithCompression(context.Background(), EncodingIdentity)
+	if err := clt.CreateFileContext(ctx, "public/c.txt", &FileInfo{Size: 5, contentType: "text/plain"}, strings.NewReader("plain")); err != nil {
+		t.Fatal(err)
+	}
+	ctx = WithCompression(context.Background(), EncodingDeflate)
+	if err := clt.CreateFileContext(ctx, "public/d.bin", &FileInfo{Size: 5}, strings.NewReader("bytes")); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, enc := range map[string]string{"a.txt": "gzip", "b.bin": "", "c.txt": "", "d.bin": "deflate"} {
+		fi, err := clt.GetInfo("public/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.MetaData()[EncodingMeta] != enc {
+			t.Errorf("%s: expected encoding %q, got %q", name, enc, fi.MetaData()[EncodingMeta])
+		}
+	}
+	if buf := readAll(t, clt, "public/a.txt"); string(buf) != data {
+		t.Error("decompressed content differs")
+	}
+	if buf := readAll(t, clt, "public/d.bin"); string(buf) != "bytes" {
+		t.Errorf("expected bytes, got %s", buf)
+	}
+}
+
+func TestCompressionSize(t *testing.T) {
+	clt, _ := newTestClient(t, Compression(EncodingGzip))
+	fi := &FileInfo{contentType: "text/plain"}
+	if err := clt.CreateFile("public/x", fi, strings.NewReader("no size")); !errors.Is(err, ErrLengthRequired) {
+		t.Errorf("expected length required, got %v", err)
+	}
+	if err := clt.CreateFile("public/x", &FileInfo{Size: 4}, strings.NewReader("important")); err == nil {
+		t.Error("expected content longer than size error, got <nil>")
+	}
+	if err := clt.Exist("public/x"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected nothing stored, got %v", err)
+	}
+}
+
+func TestDecompressFailure(t *testing.T) {
+	var open, closed atomic.Int64
+	clt, _ := newTestClient(t, Use(func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.RoundTrip(req)
+			if err == nil && req.Method == "GET" && resp.Header.Get("X-Meta-"+EncodingMeta) != "" {
+				open.Add(1)
+				resp.Body = closeCounter{resp.Body, &closed}
+			}
+			return resp, err
+		})
+	}))
+	meta := map[string]string{EncodingMeta: "gzip"}
+	if err := clt.CreateFile("public/bad", &FileInfo{Size: 5, metaData: meta}, strings.NewReader("plain")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := clt.Get("public/bad"); err == nil {
+		t.Error("expected decompression error, got <nil>")
+	}
+	if open.Load() != 1 || closed.Load() != 1 {
+		t.Errorf("expected response body closed, %d of %d closed", closed.Load(), open.Load())
+	}
+}
+
+type closeCounter struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (c closeCounter) Close() error {
+	c.n.Add(1)
+	return c.ReadCloser.Close()
+}
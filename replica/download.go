@@ -0,0 +1,373 @@
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// PartSuffix is appended to name of a local file to name the partial
+	// file it is downloaded into
+	PartSuffix = ".part"
+	// partStateSuffix names the file recording which version of remote file
+	// the partial file belongs to
+	partStateSuffix = ".json"
+
+	defaultPartSize = 8 << 20
+)
+
+// partState identifies version of remote file a partial download is of,
+// for parallel download it records which parts are done
+type partState struct {
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	PartSize int64     `json:"part_size,omitempty"`
+	Done     []bool    `json:"done,omitempty"`
+}
+
+// DownloadFile downloads remote file into local path. Content is written
+// to a partial file renamed to local on completion, an interrupted download
+// is resumed with Range request from the partial length, either right away
+// up to opts.Retries times or by calling DownloadFile again, as long as size
+// and modification time of the remote file did not change. With more than
+// one opts.Connections the file is fetched as ranges of opts.PartSize at
+// once into preallocated partial file, failed ranges are repeated alone.
+func (c *Client) DownloadFile(remote, local string, opts *DownloadOptions) (*FileInfo, error) {
+	return c.DownloadFileContext(context.Background(), remote, local, opts)
+}
+
+// DownloadFileContext is like DownloadFile but carries ctx
+func (c *Client) DownloadFileContext(ctx context.Context, remote, local string, opts *DownloadOptions) (*FileInfo, error) {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+	fi, err := c.GetInfoIf(ctx, remote, opts.Preconditions)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir {
+		return nil, fmt.Errorf("%s: is a directory", remote)
+	}
+	d := &download{c: c, remote: remote, size: fi.Size, stored: fi.Size}
+	switch {
+	case fi.chunked():
+		if d.m, err = c.getManifest(ctx, remote); err != nil {
+			return nil, err
+		}
+		d.size = d.m.Size
+	case fi.metaData[EncodingMeta] != "":
+		d.size, d.whole = fi.LogicalSize(), true
+	default:
+		if d.e, err = c.encryptionOf(ctx, fi.metaData); err != nil {
+			return nil, err
+		}
+		if d.e != nil {
+			d.size = d.e.plainSize(fi.Size)
+		}
+	}
+	size := d.size
+	var partSize int64
+	if opts.Connections > 1 && d.e == nil && !d.whole {
+		if partSize = opts.PartSize; partSize <= 0 {
+			partSize = defaultPartSize
+		}
+		if size <= partSize {
+			partSize = 0
+		}
+	}
+	part := local + PartSuffix
+	f, st, err := openPart(part, fi, size, partSize)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Progress != nil {
+		ctx = context.WithValue(ctx, progressKey{}, newTracker(opts.Progress, size))
+	}
+	if t := progressFrom(ctx); t != nil && t.fixed {
+		// count content downloaded before into fixed total
+		t.add(st.have(f, size), false)
+	}
+	if !fi.ModTime.IsZero() {
+		d.lastMod = fi.ModTime.UTC().Format(http.TimeFormat)
+	}
+	if partSize > 0 {
+		err = d.parts(ctx, f, part+partStateSuffix, st, opts)
+	} else {
+		for attempt := 0; ; attempt++ {
+			err = d.resume(ctx, f)
+			if _, ok := err.(*HTTPError); ok || err == nil || errors.Is(err, ErrRangeNotSupported) ||
+				attempt >= opts.Retries || ctx.Err() != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = d.verify(f, st)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sum := fi.Checksum(); sum != "" && fi.rangeable() {
+		if err = verifyPart(part, remote, sum); err != nil {
+			return nil, err
+		}
+	}
+	if err = os.Rename(part, local); err != nil {
+		return nil, err
+	}
+	os.Remove(part + partStateSuffix)
+	if mt := fi.ModTime; !mt.IsZero() {
+		if err = os.Chtimes(local, mt, mt); err != nil {
+			return nil, err
+		}
+	}
+	if opts.MetaSidecar {
+		if err = writeSidecar(local, fi); err != nil {
+			return nil, err
+		}
+	}
+	fi.Size = size
+	return fi, nil
+}
+
+// openPart opens partial file for download of fi, keeping its content when
+// it belongs to the same version of remote file downloaded the same way
+func openPart(part string, fi *FileInfo, size, partSize int64) (*os.File, *partState, error) {
+	st := &partState{Size: fi.Size, ModTime: fi.ModTime.UTC(), PartSize: partSize}
+	if partSize > 0 {
+		st.Done = make([]bool, (size+partSize-1)/partSize)
+	}
+	if buf, err := os.ReadFile(part + partStateSuffix); err == nil {
+		old := &partState{}
+		if json.Unmarshal(buf, old) == nil && old.Size == st.Size && old.ModTime.Equal(st.ModTime) &&
+			old.PartSize == st.PartSize && len(old.Done) == len(st.Done) {
+			if f, err := os.OpenFile(part, os.O_WRONLY, 0644); err == nil {
+				return f, old, nil
+			}
+		}
+	}
+	// truncate before state is written, so stale content is never resumed
+	f, err := os.Create(part)
+	if err == nil && partSize > 0 {
+		err = f.Truncate(size)
+	}
+	if err == nil {
+		err = st.save(part + partStateSuffix)
+	}
+	if err != nil {
+		if f != nil {
+			f.Close()
+		}
+		return nil, nil, err
+	}
+	return f, st, nil
+}
+
+func (st *partState) save(p string) error {
+	buf, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, buf, 0644)
+}
+
+// have returns how many bytes of size are already in partial file f
+func (st *partState) have(f *os.File, size int64) int64 {
+	if st.PartSize == 0 {
+		fi, err := f.Stat()
+		if err != nil {
+			return 0
+		}
+		return min(fi.Size(), size)
+	}
+	var n int64
+	for i, done := range st.Done {
+		if done {
+			n += min(st.PartSize, size-int64(i)*st.PartSize)
+		}
+	}
+	return n
+}
+
+// verifyPart checks partial file matches checksum sum of remote file,
+// dropping the partial file when it does not
+func verifyPart(part, remote, sum string) error {
+	f, err := os.Open(part)
+	if err != nil {
+		return err
+	}
+	err = verifyFile(f, remote, sum)
+	f.Close()
+	if errors.Is(err, ErrChecksumMismatch) {
+		os.Remove(part)
+		os.Remove(part + partStateSuffix)
+	}
+	return err
+}
+
+// download is a download of a single remote file
+type download struct {
+	c       *Client
+	remote  string
+	m       *manifest   // manifest of file uploaded in chunks or nil
+	e       *encryption // encryption of encrypted file or nil
+	whole   bool        // content is compressed and read only whole
+	size    int64
+	stored  int64  // size of stored content
+	lastMod string // Last-Modified of the file version downloaded
+}
+
+// resume appends rest of remote file to partial file f
+func (d *download) resume(ctx context.Context, f *os.File) error {
+	off, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if off > d.size {
+		if err = f.Truncate(0); err != nil {
+			return err
+		}
+		if off, err = f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	if off == d.size {
+		return nil
+	}
+	if d.whole && off > 0 {
+		off = 0
+		if err = f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	if d.e != nil && off%d.e.chunk != 0 {
+		// decryption starts at chunk boundary
+		off -= off % d.e.chunk
+		if err = f.Truncate(off); err != nil {
+			return err
+		}
+		if _, err = f.Seek(off, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	return d.copyRange(ctx, f, off, d.size-off)
+}
+
+// parts downloads parts of remote file not done yet into partial file f
+// with opts.Connections at once, recording done parts into state file sp
+func (d *download) parts(ctx context.Context, f *os.File, sp string, st *partState, opts *DownloadOptions) error {
+	sem := make(chan struct{}, opts.Connections)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex // guards st and errs
+		errs []error
+	)
+	for i, done := range st.Done {
+		if done {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		off := int64(i) * st.PartSize
+		n := st.PartSize
+		if rest := d.size - off; rest < n {
+			n = rest
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() { <-sem; wg.Done() }()
+			var err error
+			for attempt := 0; ; attempt++ {
+				err = d.copyRange(ctx, io.NewOffsetWriter(f, off), off, n)
+				if _, ok := err.(*HTTPError); ok || err == nil || errors.Is(err, ErrRangeNotSupported) ||
+					attempt >= opts.Retries || ctx.Err() != nil {
+					break
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				st.Done[i] = true
+				err = st.save(sp)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("bytes %d-%d: %w", off, off+n-1, err))
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// copyRange copies n bytes of remote file starting at off into w
+func (d *download) copyRange(ctx context.Context, w io.Writer, off, n int64) error {
+	var body io.ReadCloser
+	switch {
+	case d.m != nil:
+		body = d.c.readChunks(ctx, d.m, off)
+	case d.whole:
+		var err error
+		if _, body, err = d.c.getBody(ctx, d.remote, Preconditions{}); err != nil {
+			return err
+		}
+	case d.e != nil:
+		// off is at chunk boundary
+		i := off / d.e.chunk
+		soff := i * (d.e.chunk + int64(d.e.aead.Overhead()))
+		rc, err := d.c.getRange(ctx, d.remote, soff, d.stored-soff, d.lastMod)
+		if err != nil {
+			return err
+		}
+		body = d.e.decrypt(rc, d.remote, i)
+	default:
+		var err error
+		if body, err = d.c.getRange(ctx, d.remote, off, n, d.lastMod); err != nil {
+			return err
+		}
+	}
+	defer body.Close()
+	written, err := io.Copy(w, io.LimitReader(body, n))
+	if err == nil && written < n {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// verify checks partial file f has size of remote file and all its parts
+// recorded in st were downloaded
+func (d *download) verify(f *os.File, st *partState) error {
+	for i, done := range st.Done {
+		if !done {
+			return fmt.Errorf("%s: part %d not downloaded", d.remote, i)
+		}
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() != d.size {
+		return fmt.Errorf("%s: expected %d bytes, got %d", d.remote, d.size, fi.Size())
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package replica
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// cutServer aborts the first cuts file downloads after limit bytes and
+// records Range headers of downloads
+type cutServer struct {
+	h      http.Handler
+	limit  int
+	mu     sync.Mutex
+	cuts   int
+	ranges []string
+}
+
+func (s *cutServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" || r.URL.Path == "/token" {
+		s.h.ServeHTTP(w, r)
+		return
+	}
+	s.mu.Lock()
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	cut := s.cuts > 0
+	s.cuts--
+	s.mu.Unlock()
+	if !cut {
+		s.h.ServeHTTP(w, r)
+		return
+	}
+	s.h.ServeHTTP(&cutWriter{ResponseWriter: w, left: s.limit}, r)
+}
+
+type cutWriter struct {
+	http.ResponseWriter
+	left int
+}
+
+func (w *cutWriter) Write(p []byte) (int, error) {
+	if len(p) <= w.left {
+		w.left -= len(p)
+		return w.ResponseWriter.Write(p)
+	}
+	w.ResponseWriter.Write(p[:w.left])
+	w.ResponseWriter.(http.Flusher).Flush()
+	panic(http.ErrAbortHandler)
+}
+
+func newCutClient(t *testing.T, limit int, opts ...func(*Client)) (*Client, *cutServer) {
+	_, srv := newTestClient(t)
+	cs := &cutServer{h: srv, limit: limit}
+	ts := httptest.NewServer(cs)
+	t.Cleanup(ts.Close)
+	opts = append([]func(*Client){AssignCredentials("test", "secret")}, opts...)
+	clt, err := NewClient(ts.URL, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clt, cs
+}
+
+func TestDownloadFile(t *testing.T) {
+	clt, cs := newCutClient(t, 1000)
+	data := randomData(3000)
+	if err := clt.CreateFile("public/big", &FileInfo{Size: 3000}, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	local := filepath.Join(t.TempDir(), "big")
+
+	cs.cuts = 2
+	if _, err := clt.DownloadFile("public/big", local, &DownloadOptions{Retries: 1}); err == nil {
+		t.Fatal("expected error, got <nil>")
+	}
+	if _, err := os.Stat(local); !os.IsNotExist(err) {
+		t.Errorf("expected no file before completion, got %v", err)
+	}
+	// rerun continues from what previous run left
+	fi, err := clt.DownloadFile("public/big", local, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"bytes=0-2999", "bytes=1000-2999", "bytes=2000-2999"}; len(cs.ranges) != len(want) ||
+		cs.ranges[0] != want[0] || cs.ranges[1] != want[1] || cs.ranges[2] != want[2] {
+		t.Errorf("expected ranges %q, got %q", want, cs.ranges)
+	}
+	buf, err := os.ReadFile(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data) {
+		t.Error("downloaded content differs")
+	}
+	st, _ := os.Stat(local)
+	if !st.ModTime().Truncate(time.Second).Equal(fi.ModTime) {
+		t.Errorf("expected mod time %v, got %v", fi.ModTime, st.ModTime())
+	}
+	for _, p := range []string{local + PartSuffix, local + PartSuffix + partStateSuffix} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("expected %s removed, got %v", p, err)
+		}
+	}
+}
+
+func TestDownloadFileChanged(t *testing.T) {
+	clt, cs := newCutClient(t, 1000)
+	if err := clt.CreateFile("public/big", &FileInfo{Size: 3000}, bytes.NewReader(randomData(3000))); err != nil {
+		t.Fatal(err)
+	}
+	local := filepath.Join(t.TempDir(), "big")
+	cs.cuts = 1
+	if _, err := clt.DownloadFile("public/big", local, nil); err == nil {
+		t.Fatal("expected error, got <nil>")
+	}
+
+	data := randomData(2500)
+	if err := clt.Remove("public/big"); err != nil {
+		t.Fatal(err)
+	}
+	if err := clt.CreateFile("public/big", &FileInfo{Size: 2500}, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clt.DownloadFile("public/big", local, nil); err != nil {
+		t.Fatal(err)
+	}
+	if cs.ranges[1] != "bytes=0-2499" {
+		t.Errorf("expected download from start, got range %q", cs.ranges[1])
+	}
+	buf, _ := os.ReadFile(local)
+	if !bytes.Equal(buf, data) {
+		t.Error("downloaded content differs")
+	}
+}
+
+func TestDownloadFileParallel(t *testing.T) {
+	clt, cs := newCutClient(t, 500)
+	data := randomData(10000)
+	if err := clt.CreateFile("public/big", &FileInfo{Size: 10000}, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	local := filepath.Join(t.TempDir(), "big")
+	cs.cuts = 3
+	opts := &DownloadOptions{Connections: 4, PartSize: 1000, Retries: 1}
+	if _, err := clt.DownloadFile("public/big", local, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(cs.ranges) != 13 {
+		t.Errorf("expected 13 range requests, got %q", cs.ranges)
+	}
+	buf, _ := os.ReadFile(local)
+	if !bytes.Equal(buf, data) {
+		t.Error("downloaded content differs")
+	}
+
+	// failed parts are fetched again on rerun
+	os.Remove(local)
+	cs.cuts, cs.ranges = 2, nil
+	opts.Retries = 0
+	if _, err := clt.DownloadFile("public/big", local, opts); err == nil {
+		t.Fatal("expected error, got <nil>")
+	}
+	if _, err := clt.DownloadFile("public/big", local, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(cs.ranges) != 12 {
+		t.Errorf("expected 12 range requests, got %q", cs.ranges)
+	}
+	buf, _ = os.ReadFile(local)
+	if !bytes.Equal(buf, data) {
+		t.Error("downloaded content differs")
+	}
+	// preallocated partial file has full size before all parts are done
+	f, st, err := openPart(local+PartSuffix, &FileInfo{Size: 2000}, 2000, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	st.Done[0] = true
+	d := &download{remote: "public/big", size: 2000}
+	if err := d.verify(f, st); err == nil {
+		t.Error("expected part not downloaded error, got <nil>")
+	}
+}
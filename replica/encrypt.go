@@ -0,0 +1,353 @@
+package replica
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Metadata keys describing encryption of a file
+const (
+	EncryptionMeta          = "Encryption"
+	EncryptionKeyIDMeta     = "Encryption-Key-Id"
+	EncryptionNonceMeta     = "Encryption-Nonce"
+	EncryptionChunkSizeMeta = "Encryption-Chunk-Size"
+)
+
+// encChunkSize is size of plain text sealed at once
+const encChunkSize = 64 << 10
+
+// ErrDecryption is returned when encrypted content fails authentication
+var ErrDecryption = errors.New("replica: decryption failed")
+
+// KeyProvider provides keys for client side encryption, keys are 16, 24
+// or 32 bytes long selecting AES-128, AES-192 or AES-256
+type KeyProvider interface {
+	// EncryptionKey returns ID and key to encrypt new files with
+	EncryptionKey(ctx context.Context) (id string, key []byte, err error)
+	// DecryptionKey returns key with ID id
+	DecryptionKey(ctx context.Context, id string) ([]byte, error)
+}
+
+// StaticKeys is KeyProvider of a fixed set of keys by ID, new files are
+// encrypted with key Current
+type StaticKeys struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+// EncryptionKey implements KeyProvider
+func (k *StaticKeys) EncryptionKey(ctx context.Context) (string, []byte, error) {
+	key, err := k.DecryptionKey(ctx, k.Current)
+	return k.Current, key, err
+}
+
+// DecryptionKey implements KeyProvider
+func (k *StaticKeys) DecryptionKey(ctx context.Context, id string) ([]byte, error) {
+	key, ok := k.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("replica: unknown key %q", id)
+	}
+	return key, nil
+}
+
+// Encryption makes client encrypt uploaded files with AES-GCM using keys of
+// kp and decrypt downloaded ones. Content is sealed in chunks of 64 KiB
+// authenticated separately, the algorithm, key ID and nonce are recorded in
+// Encryption metadata.
+func Encryption(kp KeyProvider) func(*Client) {
+	return func(c *Client) {
+		c.keys = kp
+	}
+}
+
+// encryption seals or opens content of a single file
+type encryption struct {
+	aead   cipher.AEAD
+	prefix []byte // nonce prefix unique for the file
+	chunk  int64  // plain text chunk size
+}
+
+func newEncryption(key, prefix []byte, chunk int64) (*encryption, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(prefix) != aead.NonceSize()-4 || chunk <= 0 {
+		return nil, errors.New("replica: invalid encryption parameters")
+	}
+	return &encryption{aead: aead, prefix: prefix, chunk: chunk}, nil
+}
+
+// nonce returns nonce of chunk i, the prefix followed by chunk counter
+func (e *encryption) nonce(i int64) []byte {
+	n := make([]byte, e.aead.NonceSize())
+	copy(n, e.prefix)
+	binary.BigEndian.PutUint32(n[len(e.prefix):], uint32(i))
+	return n
+}
+
+// aad is additional data of chunk, it marks the final one so truncated
+// content fails authentication
+func aad(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// sealedSize returns size of content of plain size once sealed, empty
+// content takes a single empty chunk
+func (e *encryption) sealedSize(size int64) int64 {
+	n := (size + e.chunk - 1) / e.chunk
+	if n == 0 {
+		n = 1
+	}
+	return size + n*int64(e.aead.Overhead())
+}
+
+// plainSize is inverse of sealedSize
+func (e *encryption) plainSize(size int64) int64 {
+	sealed := e.chunk + int64(e.aead.Overhead())
+	return size - (size+sealed-1)/sealed*int64(e.aead.Overhead())
+}
+
+// encrypt returns fi with metadata of encryption and sealed size and r
+// sealing size bytes of read with the current key
+func (c *Client) encrypt(ctx context.Context, fi *FileInfo, read io.Reader) (*FileInfo, io.Reader, error) {
+	id, key, err := c.keys.EncryptionKey(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	prefix := make([]byte, 8)
+	if _, err = rand.Read(prefix); err != nil {
+		return nil, nil, err
+	}
+	e, err := newEncryption(key, prefix, encChunkSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	if (fi.Size+e.chunk-1)/e.chunk > math.MaxUint32 {
+		return nil, nil, errors.New("replica: file too big to encrypt")
+	}
+	efi := *fi
+	efi.Size = e.sealedSize(fi.Size)
+	efi.metaData = withLogicalSize(fi.metaData, fi.Size)
+	efi.metaData = withMeta(efi.metaData, EncryptionMeta, fmt.Sprintf("AES-%d-GCM", len(key)*8))
+	efi.metaData[EncryptionKeyIDMeta] = id
+	efi.metaData[EncryptionNonceMeta] = hex.EncodeToString(prefix)
+	efi.metaData[EncryptionChunkSizeMeta] = strconv.FormatInt(e.chunk, 10)
+
+	r := &sealer{e: e, src: read, size: fi.Size}
+	if s, ok := read.(io.Seeker); ok {
+		if r.start, err = s.Seek(0, io.SeekCurrent); err == nil {
+			return &efi, &seekSealer{r, s}, nil
+		}
+	}
+	return &efi, r, nil
+}
+
+// encryptionOf returns encryption of file with metadata meta, or nil when
+// the file is not encrypted
+func (c *Client) encryptionOf(ctx context.Context, meta map[string]string) (*encryption, error) {
+	if meta[EncryptionMeta] == "" {
+		return nil, nil
+	}
+	if c.keys == nil {
+		return nil, errors.New("replica: file is encrypted, client has no key provider")
+	}
+	key, err := c.keys.DecryptionKey(ctx, meta[EncryptionKeyIDMeta])
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := hex.DecodeString(meta[EncryptionNonceMeta])
+	if err != nil {
+		return nil, err
+	}
+	chunk := int64(encChunkSize)
+	if v := meta[EncryptionChunkSizeMeta]; v != "" {
+		if chunk, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	e, err := newEncryption(key, prefix, chunk)
+	if err == nil && meta[EncryptionMeta] != fmt.Sprintf("AES-%d-GCM", len(key)*8) {
+		err = fmt.Errorf("replica: unsupported encryption %s", meta[EncryptionMeta])
+	}
+	return e, err
+}
+
+// sealer encrypts size bytes of src
+type sealer struct {
+	e     *encryption
+	src   io.Reader
+	size  int64 // plain text size
+	start int64 // offset of plain text in src
+	i     int64 // index of next chunk
+	buf   []byte
+	plain []byte
+}
+
+func (r *sealer) chunks() int64 {
+	if n := (r.size + r.e.chunk - 1) / r.e.chunk; n > 0 {
+		return n
+	}
+	return 1
+}
+
+// seal reads and seals chunk r.i
+func (r *sealer) seal() error {
+	n := r.size - r.i*r.e.chunk
+	if n > r.e.chunk {
+		n = r.e.chunk
+	}
+	if int64(cap(r.plain)) < n {
+		r.plain = make([]byte, r.e.chunk)
+	}
+	if _, err := io.ReadFull(r.src, r.plain[:n]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	final := r.i == r.chunks()-1
+	if final {
+		if err := checkEOF(r.src); err != nil {
+			return err
+		}
+	}
+	r.buf = r.e.aead.Seal(r.buf[:0], r.e.nonce(r.i), r.plain[:n], aad(final))
+	r.i++
+	return nil
+}
+
+func (r *sealer) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.i >= r.chunks() {
+			return 0, io.EOF
+		}
+		if err := r.seal(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// seekSealer is sealer of seekable source, it can be rewound for retries
+type seekSealer struct {
+	*sealer
+	s io.Seeker
+}
+
+func (r *seekSealer) Seek(offset int64, whence int) (int64, error) {
+	sealed := r.e.chunk + int64(r.e.aead.Overhead())
+	size := r.e.sealedSize(r.size)
+	pos := min(r.i*sealed, size) - int64(len(r.buf))
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += pos
+	case io.SeekEnd:
+		offset += size
+	default:
+		return 0, errors.New("replica: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("replica: negative offset")
+	}
+	if offset == pos {
+		return pos, nil
+	}
+	k := offset / sealed
+	if _, err := r.s.Seek(r.start+k*r.e.chunk, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r.i, r.buf = k, r.buf[:0]
+	if k < r.chunks() {
+		if err := r.seal(); err != nil {
+			return 0, err
+		}
+		r.buf = r.buf[min(offset-k*sealed, int64(len(r.buf))):]
+	}
+	return offset, nil
+}
+
+// opener decrypts sealed chunks of src starting with chunk i
+type opener struct {
+	e    *encryption
+	name string
+	src  *bufio.Reader
+	c    io.Closer
+	i    int64
+	last int64 // index of final chunk, or -1 when it ends the content
+	in   []byte
+	buf  []byte
+	done bool
+}
+
+// decrypt returns reader of plain text of sealed content r starting with
+// chunk i, name is used in errors
+func (e *encryption) decrypt(r io.ReadCloser, name string, i int64) io.ReadCloser {
+	return e.decryptRange(r, name, i, -1)
+}
+
+// decryptRange is like decrypt for content r ending before the final chunk
+// of the file, which has index last
+func (e *encryption) decryptRange(r io.ReadCloser, name string, i, last int64) io.ReadCloser {
+	sealed := int(e.chunk) + e.aead.Overhead()
+	return &opener{e: e, name: name, src: bufio.NewReaderSize(r, sealed+1), c: r, i: i, last: last}
+}
+
+func (r *opener) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if r.in == nil {
+			r.in = make([]byte, int(r.e.chunk)+r.e.aead.Overhead())
+		}
+		n, err := io.ReadFull(r.src, r.in)
+		final := err == io.ErrUnexpectedEOF
+		switch {
+		case err == io.EOF:
+			// content ended without final chunk
+			return 0, io.ErrUnexpectedEOF
+		case err == nil:
+			_, perr := r.src.Peek(1)
+			if perr != nil && perr != io.EOF {
+				return 0, perr
+			}
+			final = perr == io.EOF
+		case !final:
+			return 0, err
+		}
+		if r.last >= 0 {
+			final = r.i == r.last
+		}
+		if r.buf, err = r.e.aead.Open(r.in[:0], r.e.nonce(r.i), r.in[:n], aad(final)); err != nil {
+			return 0, fmt.Errorf("%s: chunk %d: %w", r.name, r.i, ErrDecryption)
+		}
+		r.i++
+		r.done = final
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *opener) Close() error { return r.c.Close() }
@@ -0,0 +1,261 @@
+package replica
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"testing/iotest"
+)
+
+var testKeys = &StaticKeys{
+	Current: "k1",
+	Keys: map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 16),
+	},
+}
+
+func TestEncryption(t *testing.T) {
+	clt, srv := newTestClient(t, Encryption(testKeys), Checksum(ChecksumSHA256))
+	plain, _ := NewClient(srv.URL, AssignCredentials("test", "secret"))
+	for _, size := range []int{0, 1, encChunkSize, encChunkSize + 1, 3*encChunkSize + 100} {
+		data := randomData(size)
+		name := fmt.Sprintf("public/f%d", size)
+		var r io.Reader = bytes.NewReader(data)
+		if size%2 == 1 {
+			r = struct{ io.Reader }{r}
+		}
+		if err := clt.CreateFile(name, &FileInfo{Size: int64(size)}, r); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		fi, err := clt.GetInfo(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks := (size + encChunkSize - 1) / encChunkSize
+		if chunks == 0 {
+			chunks = 1
+		}
+		if want := int64(size + chunks*16); fi.Size != want {
+			t.Errorf("%s: expected stored size %d, got %d", name, want, fi.Size)
+		}
+		meta := fi.MetaData()
+		if meta[EncryptionMeta] != "AES-256-GCM" || meta[EncryptionKeyIDMeta] != "k1" || len(meta[EncryptionNonceMeta]) != 16 {
+			t.Errorf("%s: unexpected metadata %v", name, meta)
+		}
+
+		rc, _, err := clt.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if !bytes.Equal(buf, data) {
+			t.Errorf("%s: decrypted content differs", name)
+		}
+
+		stored, err := plain.getRange(context.Background(), name, 0, fi.Size, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, _ = io.ReadAll(stored)
+		stored.Close()
+		if size >= 16 && bytes.Contains(buf, data) {
+			t.Errorf("%s: content stored in plain text", name)
+		}
+	}
+	if _, _, err := plain.Get("public/f1"); err == nil {
+		t.Error("expected error reading encrypted file without keys, got <nil>")
+	}
+	if _, err := plain.Open("public/f1"); err == nil {
+		t.Error("expected error opening encrypted file without keys, got <nil>")
+	}
+}
+
+func TestEncryptionOpen(t *testing.T) {
+	clt, _ := newTestClient(t, Encryption(testKeys), ReadAhead(256))
+	data := randomData(3*encChunkSize + 100)
+	if err := clt.CreateFile("public/f", &FileInfo{Size: int64(len(data))}, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	f, err := clt.Open("public/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.Size() != int64(len(data)) {
+		t.Errorf("expected plain size %d, got %d", len(data), f.Size())
+	}
+	// ranges within a chunk, across chunks and in the final one
+	for _, r := range [][2]int{{10, 100}, {encChunkSize - 10, 20}, {encChunkSize / 2, 2 * encChunkSize}, {3*encChunkSize + 50, 50}} {
+		buf := make([]byte, r[1])
+		if n, err := f.ReadAt(buf, int64(r[0])); n != r[1] || err != nil || !bytes.Equal(buf, data[r[0]:r[0]+r[1]]) {
+			t.Errorf("bytes %d-%d: got %d %v", r[0], r[0]+r[1]-1, n, err)
+		}
+	}
+	// TestReader reads every byte on its own, so test it with a single chunk
+	small := data[:3000]
+	if err := clt.CreateFile("public/small", &FileInfo{Size: int64(len(small))}, bytes.NewReader(small)); err != nil {
+		t.Fatal(err)
+	}
+	sf, err := clt.Open("public/small")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf.Close()
+	if err := iotest.TestReader(sf, small); err != nil {
+		t.Fatal(err)
+	}
+
+	ff, err := clt.FS("public").Open("f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ff.Close()
+	if buf, err := io.ReadAll(ff); err != nil || !bytes.Equal(buf, data) {
+		t.Errorf("expected content through FS, got %d bytes, %v", len(buf), err)
+	}
+	// Stat and ReadDir report plain sizes like opened files
+	if err := clt.CreateDir("public/fs", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := clt.CreateFile("public/fs/small", &FileInfo{Size: int64(len(small))}, bytes.NewReader(small)); err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(clt.FS("public/fs"), "small"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncryptionSize(t *testing.T) {
+	clt, _ := newTestClient(t, Encryption(testKeys))
+	for _, r := range []io.Reader{strings.NewReader("important data"), struct{ io.Reader }{strings.NewReader("important data")}} {
+		if err := clt.CreateFile("public/x", &FileInfo{Size: 4}, r); err == nil {
+			t.Errorf("%T: expected content longer than size error, got <nil>", r)
+		}
+		if err := clt.Exist("public/x"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%T: expected nothing stored, got %v", r, err)
+		}
+	}
+}
+
+func TestEncryptionKeyRotation(t *testing.T) {
+	keys := &StaticKeys{Current: "k1", Keys: testKeys.Keys}
+	clt, _ := newTestClient(t, Encryption(keys))
+	if err := clt.CreateFile("public/old", &FileInfo{Size: 3}, strings.NewReader("old")); err != nil {
+		t.Fatal(err)
+	}
+	keys.Current = "k2"
+	if err := clt.CreateFile("public/new", &FileInfo{Size: 3}, strings.NewReader("new")); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"public/old": "old", "public/new": "new"} {
+		rc, _, err := clt.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(buf) != want {
+			t.Errorf("%s: expected %s, got %s, %v", name, want, buf, err)
+		}
+	}
+	fi, _ := clt.GetInfo("public/new")
+	if fi.MetaData()[EncryptionMeta] != "AES-128-GCM" {
+		t.Errorf("unexpected metadata %v", fi.MetaData())
+	}
+}
+
+func TestEncryptionTampered(t *testing.T) {
+	clt, srv := newTestClient(t, Encryption(testKeys))
+	plain, _ := NewClient(srv.URL, AssignCredentials("test", "secret"))
+	data := randomData(2*encChunkSize + 10)
+	if err := clt.CreateFile("public/f", &FileInfo{Size: int64(len(data))}, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	fi, _ := clt.GetInfo("public/f")
+	rc, _ := plain.getRange(context.Background(), "public/f", 0, fi.Size, "")
+	stored, _ := io.ReadAll(rc)
+	rc.Close()
+
+	flipped := append([]byte(nil), stored...)
+	flipped[100] ^= 1
+	truncated := stored[:encChunkSize+16]
+	for name, content := range map[string][]byte{"flipped": flipped, "truncated": truncated} {
+		tfi := &FileInfo{Size: int64(len(content)), metaData: fi.MetaData()}
+		if err := plain.CreateFile("public/"+name, tfi, bytes.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+		rc, _, err := clt.Get("public/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.ReadAll(rc)
+		rc.Close()
+		if !errors.Is(err, ErrDecryption) {
+			t.Errorf("%s: expected decryption error, got %v", name, err)
+		}
+	}
+}
+
+func TestEncryptionDownloadFile(t *testing.T) {
+	clt, cs := newCutClient(t, encChunkSize+1000, Encryption(testKeys))
+	data := randomData(3 * encChunkSize)
+	if err := clt.CreateFile("public/f", &FileInfo{Size: int64(len(data))}, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	local := filepath.Join(t.TempDir(), "f")
+	cs.cuts = 1
+	fi, err := clt.DownloadFile("public/f", local, &DownloadOptions{Retries: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size != int64(len(data)) {
+		t.Errorf("expected size %d, got %d", len(data), fi.Size)
+	}
+	buf, _ := os.ReadFile(local)
+	if !bytes.Equal(buf, data) {
+		t.Error("downloaded content differs")
+	}
+	// resumed at the second chunk
+	if want := fmt.Sprintf("bytes=%d-", encChunkSize+16); len(cs.ranges) != 2 || !strings.HasPrefix(cs.ranges[1], want) {
+		t.Errorf("expected resume with %s, got %q", want, cs.ranges)
+	}
+}
+
+func TestEncryptionChunked(t *testing.T) {
+	clt, _ := newTestClient(t, Encryption(testKeys))
+	data := randomData(2500)
+	local := filepath.Join(t.TempDir(), "big")
+	os.WriteFile(local, data, 0644)
+	opts := &UploadOptions{ChunkSize: 1000, StateDir: t.TempDir()}
+	if _, err := clt.UploadFile(local, "public/big", opts); err != nil {
+		t.Fatal(err)
+	}
+	rc, _, err := clt.Get("public/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || !bytes.Equal(buf, data) {
+		t.Errorf("reassembled content differs, %v", err)
+	}
+	dst := filepath.Join(t.TempDir(), "big")
+	if _, err := clt.DownloadFile("public/big", dst, nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf, _ = os.ReadFile(dst); !bytes.Equal(buf, data) {
+		t.Error("downloaded content differs")
+	}
+}
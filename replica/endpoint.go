@@ -0,0 +1,190 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMaxFailures = 3
+	defaultCoolOff     = 30 * time.Second
+	probeTimeout       = 5 * time.Second
+)
+
+// endpoint is a replica server the client can send requests to
+type endpoint struct {
+	addr      string
+	url       *url.URL
+	failures  int       // consecutive failures
+	downUntil time.Time // zero when endpoint is up
+	probing   bool
+}
+
+func newEndpoint(addr string) (*endpoint, error) {
+	addr, err := normalizeAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &endpoint{addr: addr, url: u}, nil
+}
+
+// EndpointStatus describes health of an endpoint of multi client
+type EndpointStatus struct {
+	Address  string
+	Healthy  bool
+	Failures int
+}
+
+// AssignFailover set how many consecutive failures mark an endpoint down
+// and how long it is avoided before being health checked again
+func AssignFailover(maxFailures int, coolOff time.Duration) func(*Client) {
+	return func(c *Client) {
+		c.maxFailures = maxFailures
+		c.coolOff = coolOff
+	}
+}
+
+// Endpoints returns status of client endpoints in order of preference
+func (c *Client) Endpoints() []EndpointStatus {
+	c.epMu.Lock()
+	defer c.epMu.Unlock()
+	st := make([]EndpointStatus, len(c.endpoints))
+	for i, e := range c.endpoints {
+		st[i] = EndpointStatus{
+			Address:  e.addr,
+			Healthy:  e.downUntil.IsZero(),
+			Failures: e.failures,
+		}
+	}
+	return st
+}
+
+// HealthCheck probes all endpoints and updates their status, it returns
+// error if none of them is healthy
+func (c *Client) HealthCheck(ctx context.Context) error {
+	ok := false
+	for _, e := range c.endpoints {
+		err := c.probe(ctx, e)
+		c.report(e, err)
+		ok = ok || err == nil
+	}
+	if !ok {
+		return errors.New("no healthy endpoint")
+	}
+	return nil
+}
+
+// endpoint chooses the first healthy endpoint not in tried. Endpoints
+// which cool-off has passed are probed in background and used only when
+// no healthy one is left.
+func (c *Client) endpoint(tried []*endpoint) *endpoint {
+	c.epMu.Lock()
+	defer c.epMu.Unlock()
+	now := time.Now()
+	var fallback *endpoint
+	for _, e := range c.endpoints {
+		if containsEndpoint(tried, e) {
+			continue
+		}
+		if e.downUntil.IsZero() {
+			return e
+		}
+		if now.After(e.downUntil) && !e.probing && len(c.endpoints) > 1 {
+			e.probing = true
+			go c.reprobe(e)
+		}
+		if fallback == nil {
+			fallback = e
+		}
+	}
+	if fallback == nil {
+		fallback = c.endpoints[0]
+	}
+	return fallback
+}
+
+func containsEndpoint(es []*endpoint, e *endpoint) bool {
+	for _, x := range es {
+		if x == e {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) reprobe(e *endpoint) {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	err := c.probe(ctx, e)
+	c.report(e, err)
+	c.epMu.Lock()
+	e.probing = false
+	c.epMu.Unlock()
+}
+
+// probe checks endpoint e responds, any response but server error counts
+func (c *Client) probe(ctx context.Context, e *endpoint) error {
+	req, err := http.NewRequestWithContext(ctx, "OPTIONS", e.addr+"/", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "Replica Client v0.1")
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return &HTTPError{Code: resp.StatusCode, Message: resp.Status}
+	}
+	return nil
+}
+
+// report records result of a request to e and returns true if err
+// counts as endpoint failure
+func (c *Client) report(e *endpoint, err error) bool {
+	failed := err != nil && err != context.Canceled && err != context.DeadlineExceeded
+	if herr, ok := err.(*HTTPError); ok {
+		failed = herr.Code >= 500
+	}
+	c.epMu.Lock()
+	defer c.epMu.Unlock()
+	if !failed {
+		e.failures = 0
+		e.downUntil = time.Time{}
+		return false
+	}
+	e.failures++
+	if e.failures >= c.maxFailures {
+		e.downUntil = time.Now().Add(c.coolOff)
+	}
+	return true
+}
+
+// rebase points u built from client address to endpoint e
+func (c *Client) rebase(u *url.URL, e *endpoint) *url.URL {
+	nu := *u
+	nu.Scheme = e.url.Scheme
+	nu.Host = e.url.Host
+	nu.User = e.url.User
+	nu.Path = strings.TrimSuffix(e.url.Path, "/json") + strings.TrimPrefix(u.Path, urlRoot(c.addr))
+	nu.RawPath = ""
+	return &nu
+}
+
+// urlRoot returns path of addr without json suffix
+func urlRoot(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, "/json")
+}
@@ -0,0 +1,130 @@
+package replica
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// nodeServer counts requests and answers with code
+type nodeServer struct {
+	sync.Mutex
+	code  int
+	hits  int
+	paths []string
+}
+
+func (s *nodeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	s.hits++
+	s.paths = append(s.paths, r.URL.Path)
+	w.WriteHeader(s.code)
+}
+
+func (s *nodeServer) set(code int) {
+	s.Lock()
+	s.code = code
+	s.hits = 0
+	s.paths = nil
+	s.Unlock()
+}
+
+func (s *nodeServer) count() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.hits
+}
+
+func TestMultiClient(t *testing.T) {
+	n1, n2 := &nodeServer{code: 503}, &nodeServer{code: 200}
+	ts1, ts2 := httptest.NewServer(n1), httptest.NewServer(n2)
+	defer ts1.Close()
+	defer ts2.Close()
+
+	clt, err := NewMultiClient([]string{ts1.URL, ts2.URL + "/prefix"},
+		AssignFailover(2, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clt.Address() != ts1.URL+"/json" {
+		t.Errorf("expected address %s/json, got %s", ts1.URL, clt.Address())
+	}
+	for i := 0; i < 3; i++ {
+		if err := clt.Exist("a/b"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// first node is marked down after two failures
+	if n1.count() != 2 || n2.count() != 3 {
+		t.Errorf("expected 2 and 3 requests, got %d and %d", n1.count(), n2.count())
+	}
+	if n2.paths[0] != "/prefix/json/a/b" {
+		t.Errorf("expected path /prefix/json/a/b, got %s", n2.paths[0])
+	}
+	st := clt.Endpoints()
+	if st[0].Healthy || !st[1].Healthy {
+		t.Errorf("unexpected endpoints status %+v", st)
+	}
+
+	// not idempotent requests are not failed over
+	n1.set(503)
+	n2.set(200)
+	clt, _ = NewMultiClient([]string{ts1.URL, ts2.URL})
+	if err := clt.Update("a", nil, nil); err == nil {
+		t.Error("expected server error, got <nil>")
+	}
+	if n2.count() != 0 {
+		t.Errorf("expected no requests to second node, got %d", n2.count())
+	}
+
+	// client errors do not mark endpoint down
+	n1.set(404)
+	if err := clt.Exist("a"); err == nil {
+		t.Error("expected not found error, got <nil>")
+	}
+	if n2.count() != 0 || !clt.Endpoints()[0].Healthy {
+		t.Error("expected first node healthy")
+	}
+}
+
+func TestMultiClientCoolOff(t *testing.T) {
+	n1, n2 := &nodeServer{code: 503}, &nodeServer{code: 200}
+	ts1, ts2 := httptest.NewServer(n1), httptest.NewServer(n2)
+	defer ts1.Close()
+	defer ts2.Close()
+
+	clt, _ := NewMultiClient([]string{ts1.URL, ts2.URL},
+		AssignFailover(1, 10*time.Millisecond))
+	if err := clt.Exist("a"); err != nil {
+		t.Fatal(err)
+	}
+	if clt.Endpoints()[0].Healthy {
+		t.Fatal("expected first node down")
+	}
+	n1.set(200)
+	time.Sleep(20 * time.Millisecond)
+	// cool-off passed, the node is probed in background
+	clt.Exist("a")
+	for i := 0; i < 100 && !clt.Endpoints()[0].Healthy; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !clt.Endpoints()[0].Healthy {
+		t.Fatal("expected first node back up")
+	}
+
+	n1.set(503)
+	if err := clt.HealthCheck(context.Background()); err != nil {
+		t.Error(err)
+	}
+	if clt.Endpoints()[0].Healthy {
+		t.Error("expected first node down after health check")
+	}
+	n2.set(503)
+	if err := clt.HealthCheck(context.Background()); err == nil {
+		t.Error("expected no healthy endpoint error, got <nil>")
+	}
+}
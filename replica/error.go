@@ -1,19 +1,100 @@
 package replica
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"strings"
 )
 
+// Errors matched by HTTPError of the corresponding status with errors.Is
+var (
+	ErrNotModified        = errors.New("replica: not modified")
+	ErrBadRequest         = errors.New("replica: bad request")
+	ErrUnauthorized       = errors.New("replica: unauthorized")
+	ErrForbidden          = errors.New("replica: forbidden")
+	ErrNotFound           = errors.New("replica: not found")
+	ErrMethodNotAllowed   = errors.New("replica: method not allowed")
+	ErrConflict           = errors.New("replica: conflict")
+	ErrLengthRequired     = errors.New("replica: length required")
+	ErrPreconditionFailed = errors.New("replica: precondition failed")
+	ErrTooManyRequests    = errors.New("replica: too many requests")
+	// ErrServer is matched by all 5xx statuses
+	ErrServer = errors.New("replica: server error")
+)
+
+var statusErrors = map[int]error{
+	http.StatusNotModified:        ErrNotModified,
+	http.StatusBadRequest:         ErrBadRequest,
+	http.StatusUnauthorized:       ErrUnauthorized,
+	http.StatusForbidden:          ErrForbidden,
+	http.StatusNotFound:           ErrNotFound,
+	http.StatusMethodNotAllowed:   ErrMethodNotAllowed,
+	http.StatusConflict:           ErrConflict,
+	http.StatusLengthRequired:     ErrLengthRequired,
+	http.StatusPreconditionFailed: ErrPreconditionFailed,
+	http.StatusTooManyRequests:    ErrTooManyRequests,
+}
+
 // HTTPError http status code and error message
 type HTTPError struct {
 	Code    int    `json:"error_code"`
 	Message string `json:"error_message"`
+	Method  string `json:"-"` // of the failed request
+	Path    string `json:"-"` // resource of the failed request
 }
 
 func (r *HTTPError) Error() string {
-	return fmt.Sprintf("http error: Code: %d Message: %s", r.Code, r.Message)
+	if r.Method == "" && r.Path == "" {
+		return fmt.Sprintf("http error: Code: %d Message: %s", r.Code, r.Message)
+	}
+	return fmt.Sprintf("%s %s: http error: Code: %d Message: %s", r.Method, r.Path, r.Code, r.Message)
+}
+
+// Is makes HTTPError match sentinel error of its status
+func (r *HTTPError) Is(target error) bool {
+	if target == ErrServer {
+		return r.Code >= 500
+	}
+	return target != nil && statusErrors[r.Code] == target
+}
+
+// Temporary reports whether the status describes a transient condition of
+// the server, like overload or timeout
+func (r *HTTPError) Temporary() bool {
+	switch r.Code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Retryable reports whether the request may succeed when sent again
+// unchanged, which holds for temporary errors and internal server error.
+// Other server errors, like not implemented, persist.
+func (r *HTTPError) Retryable() bool {
+	return r.Temporary() || r.Code == http.StatusInternalServerError
+}
+
+// Retryable reports whether a request failed with err may succeed when
+// sent again, which holds for retryable HTTPError and failures to connect
+// to the server or to transfer content. Cancelled requests are not
+// retryable.
+func Retryable(err error) bool {
+	var herr *HTTPError
+	var nerr net.Error
+	switch {
+	case err == nil, errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.As(err, &herr):
+		return herr.Retryable()
+	}
+	return errors.As(err, &nerr) || errors.Is(err, io.ErrUnexpectedEOF)
 }
 
 func newHTTPError(code int, msg []byte) *HTTPError {
@@ -1,6 +1,9 @@
 package replica
 
 import (
+	"context"
+	"errors"
+	"io"
 	"testing"
 )
 
@@ -11,3 +14,79 @@ func TestErrorCover(t *testing.T) {
 		t.Errorf("expected '%s', got %s", msg, err.Error())
 	}
 }
+
+func TestErrorIs(t *testing.T) {
+	tests := []struct {
+		code      int
+		target    error
+		temporary bool
+		retryable bool
+	}{
+		{304, ErrNotModified, false, false},
+		{401, ErrUnauthorized, false, false},
+		{403, ErrForbidden, false, false},
+		{404, ErrNotFound, false, false},
+		{409, ErrConflict, false, false},
+		{411, ErrLengthRequired, false, false},
+		{412, ErrPreconditionFailed, false, false},
+		{429, ErrTooManyRequests, true, true},
+		{500, ErrServer, false, true},
+		{501, ErrServer, false, false},
+		{502, ErrServer, true, true},
+		{503, ErrServer, true, true},
+		{504, ErrServer, true, true},
+		{505, ErrServer, false, false},
+		{507, ErrServer, false, false},
+	}
+	for _, tt := range tests {
+		err := error(&HTTPError{Code: tt.code})
+		if !errors.Is(err, tt.target) {
+			t.Errorf("%d: expected to match %v", tt.code, tt.target)
+		}
+		if errors.Is(err, ErrConflict) != (tt.target == ErrConflict) {
+			t.Errorf("%d: unexpected match of conflict", tt.code)
+		}
+		herr := err.(*HTTPError)
+		if herr.Temporary() != tt.temporary || herr.Retryable() != tt.retryable || Retryable(err) != tt.retryable {
+			t.Errorf("%d: expected temporary %v and retryable %v", tt.code, tt.temporary, tt.retryable)
+		}
+	}
+
+	if Retryable(context.Canceled) || Retryable(errors.New("local")) || !Retryable(io.ErrUnexpectedEOF) {
+		t.Error("unexpected classification of plain errors")
+	}
+	clt, err := NewClient("http://127.0.0.1:1/json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := clt.Exist("f"); !Retryable(err) {
+		t.Errorf("expected retryable connection error, got %v", err)
+	}
+}
+
+func TestErrorRequest(t *testing.T) {
+	clt, _ := newTestClient(t)
+	_, _, err := clt.Get("public/none")
+	var herr *HTTPError
+	if !errors.As(err, &herr) || !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if herr.Method != "GET" || herr.Path != "public/none" {
+		t.Errorf("unexpected request %s %s", herr.Method, herr.Path)
+	}
+	msg := "GET public/none: http error: Code: 404 Message: not found"
+	if err.Error() != msg {
+		t.Errorf("expected '%s', got %s", msg, err.Error())
+	}
+
+	for name, exists := range map[string]bool{"public": true, "public/none": false, "public/none/x": false} {
+		ok, err := clt.Exists(name)
+		if err != nil || ok != exists {
+			t.Errorf("%s: expected %v, got %v %v", name, exists, ok, err)
+		}
+	}
+	bad, _ := NewClient(clt.Address())
+	if ok, err := bad.Exists("public"); ok || !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected unauthorized, got %v %v", ok, err)
+	}
+}
@@ -0,0 +1,247 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"sync"
+)
+
+const defaultReadAhead = 1 << 20
+
+// ErrRangeNotSupported is returned reading part of a file past its start
+// from a server ignoring Range requests
+var ErrRangeNotSupported = errors.New("replica: server does not support ranges")
+
+// ReadAhead set how many bytes File.Read fetches at once, reads bigger
+// than n are fetched whole
+func ReadAhead(n int) func(*Client) {
+	return func(c *Client) {
+		c.readAhead = n
+	}
+}
+
+// File is a remote file opened for random access, every read not served
+// from read-ahead buffer is a Range request
+type File struct {
+	c      *Client
+	ctx    context.Context
+	name   string
+	info   *FileInfo
+	e      *encryption // of encrypted file or nil
+	stored int64       // size of stored content
+
+	mu     sync.Mutex // guards fields below
+	off    int64
+	buf    []byte // read-ahead buffer
+	bufOff int64  // offset of buf in file
+	closed bool
+}
+
+// Open opens remote file name for reading
+func (c *Client) Open(name string) (*File, error) {
+	return c.OpenContext(context.Background(), name)
+}
+
+// OpenContext is like Open but carries ctx used by all reads of the file
+func (c *Client) OpenContext(ctx context.Context, name string) (*File, error) {
+	fi, err := c.GetInfoContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir {
+		return nil, fmt.Errorf("%s: is a directory", name)
+	}
+	if fi.chunked() || fi.metaData[EncodingMeta] != "" {
+		return nil, fmt.Errorf("%s: stored chunked or compressed, read it with Get", name)
+	}
+	return c.openFile(ctx, name, fi)
+}
+
+// openFile returns File of remote file name described by fi, content of
+// encrypted file is decrypted
+func (c *Client) openFile(ctx context.Context, name string, fi *FileInfo) (*File, error) {
+	e, err := c.encryptionOf(ctx, fi.metaData)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{c: c, ctx: ctx, name: name, info: fi, e: e, stored: fi.Size}
+	if e != nil {
+		info := *fi
+		info.Size = e.plainSize(fi.Size)
+		f.info = &info
+	}
+	return f, nil
+}
+
+// Info returns FileInfo of f, Size of encrypted file is its plain size
+func (f *File) Info() *FileInfo { return f.info }
+
+// Stat returns fs.FileInfo of f
+func (f *File) Stat() (fs.FileInfo, error) { return f.info.Stat(), nil }
+
+// Size returns size of f
+func (f *File) Size() int64 { return f.info.Size }
+
+// ReadAt reads len(p) bytes at offset off, it is safe to call ReadAt
+// concurrently
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("replica: negative offset")
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if off >= f.info.Size {
+		return 0, io.EOF
+	}
+	n := len(p)
+	if rest := f.info.Size - off; int64(n) > rest {
+		n = int(rest)
+	}
+	rc, err := f.readRange(off, int64(n))
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	n, err = io.ReadFull(rc, p[:n])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// readRange returns reader of n bytes of f at off, encrypted content is
+// read from start of the chunk holding off up to end of the one holding
+// the last byte
+func (f *File) readRange(off, n int64) (io.ReadCloser, error) {
+	if f.e == nil {
+		return f.c.getRange(f.ctx, f.name, off, n, "")
+	}
+	sealed := f.e.chunk + int64(f.e.aead.Overhead())
+	i, j := off/f.e.chunk, (off+n-1)/f.e.chunk
+	start, end := i*sealed, min((j+1)*sealed, f.stored)
+	rc, err := f.c.getRange(f.ctx, f.name, start, end-start, "")
+	if err != nil {
+		return nil, err
+	}
+	body := f.e.decryptRange(rc, f.name, i, (f.stored+sealed-1)/sealed-1)
+	if _, err = io.CopyN(io.Discard, body, off-i*f.e.chunk); err != nil {
+		body.Close()
+		return nil, err
+	}
+	return body, nil
+}
+
+// Read reads up to len(p) bytes at current offset
+func (f *File) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	if f.off >= f.info.Size {
+		return 0, io.EOF
+	}
+	if f.off < f.bufOff || f.off >= f.bufOff+int64(len(f.buf)) {
+		size := f.c.readAhead
+		if size <= 0 {
+			size = defaultReadAhead
+		}
+		if len(p) > size {
+			n, err := f.ReadAt(p, f.off)
+			f.off += int64(n)
+			if err == io.EOF && n > 0 {
+				err = nil
+			}
+			return n, err
+		}
+		if cap(f.buf) < size {
+			f.buf = make([]byte, size)
+		}
+		n, err := f.ReadAt(f.buf[:size], f.off)
+		if n == 0 {
+			return 0, err
+		}
+		f.buf, f.bufOff = f.buf[:n], f.off
+	}
+	n := copy(p, f.buf[f.off-f.bufOff:])
+	f.off += int64(n)
+	return n, nil
+}
+
+// Seek sets offset of the next Read
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += f.info.Size
+	default:
+		return 0, errors.New("replica: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("replica: negative offset")
+	}
+	f.off = offset
+	return offset, nil
+}
+
+// Close releases read-ahead buffer
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return fs.ErrClosed
+	}
+	f.closed, f.buf = true, nil
+	return nil
+}
+
+// rangeable reports whether stored content of f is the file content, so
+// its ranges can be read
+func (f *FileInfo) rangeable() bool {
+	return !f.chunked() && f.metaData[EncryptionMeta] == "" && f.metaData[EncodingMeta] == ""
+}
+
+// getRange makes GET request for n bytes of name starting at off, when
+// lastMod is set it fails unless the file was last modified at lastMod
+func (c *Client) getRange(ctx context.Context, name string, off, n int64, lastMod string) (io.ReadCloser, error) {
+	req, err := c.newRequest(ctx, "GET", name, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+n-1))
+	if lastMod != "" {
+		req.Header.Set("If-Range", lastMod)
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if lm := resp.Header.Get("Last-Modified"); lastMod != "" && lm != "" && lm != lastMod {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: changed during download", name)
+	}
+	if resp.StatusCode == http.StatusPartialContent {
+		return resp.Body, nil
+	}
+	if off > 0 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %w", name, ErrRangeNotSupported)
+	}
+	// server ignored range of the file start
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(resp.Body, n), resp.Body}, nil
+}
@@ -0,0 +1,86 @@
+package replica
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/iotest"
+)
+
+func randomData(n int) []byte {
+	buf := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(buf)
+	return buf
+}
+
+func TestOpen(t *testing.T) {
+	clt, _ := newTestClient(t, ReadAhead(256))
+	data := randomData(3000)
+	fi := &FileInfo{Size: int64(len(data))}
+	if err := clt.CreateFile("public/big", fi, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := clt.Open("public/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.Size() != int64(len(data)) {
+		t.Errorf("expected size %d, got %d", len(data), f.Size())
+	}
+	if err := iotest.TestReader(f, data); err != nil {
+		t.Fatal(err)
+	}
+
+	tail := make([]byte, 100)
+	n, err := f.ReadAt(tail, int64(len(data)-50))
+	if n != 50 || err != io.EOF || !bytes.Equal(tail[:n], data[len(data)-50:]) {
+		t.Errorf("expected 50 tail bytes and EOF, got %d %v", n, err)
+	}
+	if _, err := f.Seek(-1, io.SeekStart); err == nil {
+		t.Error("expected negative offset error, got <nil>")
+	}
+	f.Close()
+	if _, err := f.Read(tail); err == nil {
+		t.Error("expected closed file error, got <nil>")
+	}
+
+	if _, err := clt.Open("public"); err == nil {
+		t.Error("expected is a directory error, got <nil>")
+	}
+	if _, err := clt.Open("public/none"); err == nil {
+		t.Error("expected not found error, got <nil>")
+	}
+}
+
+func TestOpenNoRange(t *testing.T) {
+	data := randomData(1000)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Type", "file")
+		w.Header().Set("X-Length", "1000")
+		if r.Method == "GET" {
+			w.Write(data)
+		}
+	}))
+	defer ts.Close()
+	clt, _ := NewClient(ts.URL, ReadAhead(100))
+	f, err := clt.Open("f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	if n, err := f.Read(buf); n != 100 || err != nil || !bytes.Equal(buf, data[:100]) {
+		t.Fatalf("expected first 100 bytes, got %d %v", n, err)
+	}
+	if _, err := f.Read(buf); !errors.Is(err, ErrRangeNotSupported) {
+		t.Errorf("expected ErrRangeNotSupported, got %v", err)
+	}
+	if n, err := f.ReadAt(nil, 500); n != 0 || err != nil {
+		t.Errorf("expected empty read, got %d %v", n, err)
+	}
+}
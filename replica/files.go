@@ -41,6 +41,7 @@ func newFileInfo(resp *http.Response) *FileInfo {
 	fi.contentType = resp.Header.Get("Content-Type")
 	fi.Owner = resp.Header.Get("X-Owner")
 	fi.IsDir = resp.Header.Get("X-Type") == "dir"
+	fi.etag = resp.Header.Get("ETag")
 	if t, err := time.Parse(http.TimeFormat, resp.Header.Get("Last-Modified")); err == nil {
 		fi.ModTime = t.Local()
 	}
@@ -70,6 +71,7 @@ type FileInfo struct {
 	contentType  string
 	replicaCount int
 	metaData     map[string]string
+	etag         string
 }
 
 // ContentType returns contentType of FileInfo
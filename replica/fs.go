@@ -0,0 +1,290 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FS is a read only file system on top of a replica directory, it
+// implements fs.FS, fs.StatFS, fs.ReadDirFS and fs.ReadFileFS
+type FS struct {
+	c    *Client
+	ctx  context.Context
+	root string
+}
+
+// FS returns file system rooted at remote directory root
+func (c *Client) FS(root string) *FS {
+	return &FS{c: c, ctx: context.Background(), root: strings.Trim(root, "/")}
+}
+
+// WithContext returns a copy of f issuing requests with ctx
+func (f *FS) WithContext(ctx context.Context) *FS {
+	nf := *f
+	nf.ctx = ctx
+	return &nf
+}
+
+func (f *FS) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return f.root, nil
+	}
+	return path.Join(f.root, name), nil
+}
+
+// Open opens the named file or directory. Files stored chunked or
+// compressed are read from start to end with a single Get, they do not
+// implement io.Seeker nor io.ReaderAt.
+func (f *FS) Open(name string) (fs.File, error) {
+	fi, err := f.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir {
+		return &fsDir{fs: f, name: name, info: fi}, nil
+	}
+	p, _ := f.path("open", name)
+	if fi.chunked() || fi.metaData[EncodingMeta] != "" {
+		return f.openStream(p, name, fi)
+	}
+	file, err := f.c.openFile(f.ctx, p, fi)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return file, nil
+}
+
+// openStream returns fs.File streaming content of file p described by fi
+func (f *FS) openStream(p, name string, fi *FileInfo) (fs.File, error) {
+	info, err := f.content("open", p, name, fi)
+	if err != nil {
+		return nil, err
+	}
+	return &fsStream{fs: f, path: p, name: name, info: info}, nil
+}
+
+// content returns copy of fi of file p with size of its content, which
+// differs from stored size of files stored chunked, compressed or encrypted
+func (f *FS) content(op, p, name string, fi *FileInfo) (*FileInfo, error) {
+	info := *fi
+	info.Size = fi.LogicalSize()
+	if fi.chunked() {
+		m, err := f.c.getManifest(f.ctx, p)
+		if err != nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fsError(err)}
+		}
+		info.Size = m.Size
+	}
+	return &info, nil
+}
+
+// Stat returns FileInfo describing the named file, its size is size of the
+// content read from it
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	fi, err := f.stat("stat", name)
+	if err == nil && !fi.IsDir {
+		p, _ := f.path("stat", name)
+		fi, err = f.content("stat", p, name, fi)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fi.Stat(), nil
+}
+
+func (f *FS) stat(op, name string) (*FileInfo, error) {
+	p, err := f.path(op, name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.c.GetInfoContext(f.ctx, p)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fsError(err)}
+	}
+	fi.Name = path.Base(name)
+	return fi, nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by
+// file name. Listings report stored size of files, so Info of file entries
+// asks for size of the content like Stat.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := f.path("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	rc, files, err := f.c.GetContext(f.ctx, p)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fsError(err)}
+	}
+	if rc != nil {
+		rc.Close()
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	files = hideChunks(files)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	entries := make([]fs.DirEntry, len(files))
+	for i := range files {
+		entries[i] = files[i].DirEntry()
+		if !files[i].IsDir {
+			entries[i] = fsEntry{fsInfo{&files[i]}, f, path.Join(name, files[i].Name)}
+		}
+	}
+	return entries, nil
+}
+
+// ReadFile reads the named file and returns its contents
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	p, err := f.path("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	rc, _, err := f.c.GetContext(f.ctx, p)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fsError(err)}
+	}
+	if rc == nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errors.New("is a directory")}
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// fsError translates http errors to fs package errors
+func fsError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return fs.ErrNotExist
+	case errors.Is(err, ErrUnauthorized), errors.Is(err, ErrForbidden):
+		return fs.ErrPermission
+	}
+	return err
+}
+
+// fsStream reads a file with Get started by the first Read
+type fsStream struct {
+	fs     *FS
+	path   string
+	name   string
+	info   *FileInfo
+	rc     io.ReadCloser
+	closed bool
+}
+
+func (s *fsStream) Stat() (fs.FileInfo, error) { return s.info.Stat(), nil }
+
+func (s *fsStream) Read(p []byte) (int, error) {
+	if s.closed {
+		return 0, &fs.PathError{Op: "read", Path: s.name, Err: fs.ErrClosed}
+	}
+	if s.rc == nil {
+		rc, _, err := s.fs.c.GetContext(s.fs.ctx, s.path)
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: s.name, Err: fsError(err)}
+		}
+		if rc == nil {
+			return 0, &fs.PathError{Op: "read", Path: s.name, Err: errors.New("is a directory")}
+		}
+		s.rc = rc
+	}
+	return s.rc.Read(p)
+}
+
+func (s *fsStream) Close() error {
+	if s.closed {
+		return &fs.PathError{Op: "close", Path: s.name, Err: fs.ErrClosed}
+	}
+	s.closed = true
+	if s.rc == nil {
+		return nil
+	}
+	return s.rc.Close()
+}
+
+// fsEntry is directory entry of a file
+type fsEntry struct {
+	fsInfo
+	fs   *FS
+	name string
+}
+
+func (e fsEntry) Info() (fs.FileInfo, error) { return e.fs.Stat(e.name) }
+
+type fsDir struct {
+	fs      *FS
+	name    string
+	info    *FileInfo
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) { return d.info.Stat(), nil }
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *fsDir) Close() error { return nil }
+
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fs.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.read = entries, true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// Stat returns f as fs.FileInfo, the value also implements fs.DirEntry
+func (f *FileInfo) Stat() fs.FileInfo { return fsInfo{f} }
+
+// DirEntry returns f as fs.DirEntry
+func (f *FileInfo) DirEntry() fs.DirEntry { return fsInfo{f} }
+
+type fsInfo struct {
+	fi *FileInfo
+}
+
+func (i fsInfo) Name() string { return i.fi.Name }
+func (i fsInfo) Size() int64  { return i.fi.Size }
+func (i fsInfo) IsDir() bool  { return i.fi.IsDir }
+func (i fsInfo) Sys() any     { return i.fi }
+
+// ModTime is reported with the second resolution of http dates, so
+// listings and HEAD responses agree
+func (i fsInfo) ModTime() time.Time { return i.fi.ModTime.Truncate(time.Second).Local() }
+
+func (i fsInfo) Mode() fs.FileMode {
+	if i.fi.IsDir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (i fsInfo) Type() fs.FileMode          { return i.Mode().Type() }
+func (i fsInfo) Info() (fs.FileInfo, error) { return i, nil }
+func (i fsInfo) String() string             { return fs.FormatFileInfo(i) }
@@ -0,0 +1,109 @@
+package replica
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	clt, _ := newTestClient(t)
+	for _, d := range []string{"root", "root/dir", "root/dir/sub", "root/empty"} {
+		if err := clt.CreateDir(d, 1, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, data := range map[string]string{
+		"root/a.txt":          "hello",
+		"root/dir/b.txt":      "world",
+		"root/dir/sub/c.html": "<p>c</p>",
+	} {
+		fi := &FileInfo{Size: int64(len(data)), contentType: "text/plain"}
+		if err := clt.CreateFile(name, fi, strings.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rfs := clt.FS("root")
+	if err := fstest.TestFS(rfs, "a.txt", "dir/b.txt", "dir/sub/c.html", "empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rfs.Open("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+	if _, err := rfs.Open("../a.txt"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("expected %v, got %v", fs.ErrInvalid, err)
+	}
+	if _, err := rfs.ReadFile("dir"); err == nil {
+		t.Error("expected is a directory error, got <nil>")
+	}
+	if _, err := rfs.ReadDir("a.txt"); err == nil {
+		t.Error("expected not a directory error, got <nil>")
+	}
+
+	var names []string
+	err := fs.WalkDir(rfs, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		names = append(names, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := ". a.txt dir dir/b.txt dir/sub dir/sub/c.html empty"
+	if strings.Join(names, " ") != exp {
+		t.Errorf("expected walk %s, got %s", exp, strings.Join(names, " "))
+	}
+}
+
+func TestFSStream(t *testing.T) {
+	clt, _ := newTestClient(t, Compression(EncodingGzip))
+	data := strings.Repeat("stream ", 500)
+	if err := clt.CreateFile("public/z.txt", &FileInfo{Size: int64(len(data))}, strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	local := filepath.Join(t.TempDir(), "big")
+	if err := os.WriteFile(local, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := &UploadOptions{ChunkSize: 1000, StateDir: t.TempDir()}
+	if _, err := clt.UploadFile(local, "public/big", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	rfs := clt.FS("public")
+	// sizes reported by Stat and ReadDir are sizes of the content
+	if err := fstest.TestFS(rfs, "z.txt", "big"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"z.txt", "big"} {
+		f, err := rfs.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st, _ := f.Stat(); st.Size() != int64(len(data)) {
+			t.Errorf("%s: expected size %d, got %d", name, len(data), st.Size())
+		}
+		if _, ok := f.(io.Seeker); ok {
+			t.Errorf("%s: expected stream not implementing io.Seeker", name)
+		}
+		buf, err := io.ReadAll(f)
+		if err != nil || string(buf) != data {
+			t.Errorf("%s: expected content, got %d bytes, %v", name, len(buf), err)
+		}
+		if err := f.Close(); err != nil {
+			t.Error(err)
+		}
+		if _, err := f.Read(buf); !errors.Is(err, fs.ErrClosed) {
+			t.Errorf("%s: expected %v, got %v", name, fs.ErrClosed, err)
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package replica
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"mime"
 	"net/http"
@@ -15,14 +18,26 @@ const sniffLen = 512
 
 // GetInfo makes HEAD request to get FileInfo of resource
 func (c *Client) GetInfo(name string) (*FileInfo, error) {
-	req, err := c.newRequest("HEAD", name, nil)
+	return c.GetInfoContext(context.Background(), name)
+}
+
+// GetInfoContext is like GetInfo but carries ctx
+func (c *Client) GetInfoContext(ctx context.Context, name string) (*FileInfo, error) {
+	return c.GetInfoIf(ctx, name, Preconditions{})
+}
+
+// GetInfoIf is like GetInfoContext but fails unless the resource meets p
+func (c *Client) GetInfoIf(ctx context.Context, name string, p Preconditions) (*FileInfo, error) {
+	req, err := c.newRequest(ctx, "HEAD", name, nil)
 	if err != nil {
 		return nil, err
 	}
+	p.set(req)
 	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
+	resp.Body.Close()
 	fi := newFileInfo(resp)
 	return fi, nil
 }
@@ -30,30 +45,130 @@ func (c *Client) GetInfo(name string) (*FileInfo, error) {
 // Get makes GET request to get a resource
 // if resource is directory than Files object returned
 // if resource is file than bytes array returned
+// files uploaded in chunks are reassembled from their chunks
 func (c *Client) Get(name string) (io.ReadCloser, Files, error) {
-	req, err := c.newRequest("GET", name, nil)
+	return c.GetContext(context.Background(), name)
+}
+
+// GetContext is like Get but carries ctx, cancelling ctx aborts
+// reading of the returned body
+func (c *Client) GetContext(ctx context.Context, name string) (io.ReadCloser, Files, error) {
+	if c.cache != nil {
+		return c.getCached(ctx, name)
+	}
+	return c.GetIf(ctx, name, Preconditions{})
+}
+
+// GetIf is like GetContext but fails unless the resource meets p, it is
+// never served from Cache
+func (c *Client) GetIf(ctx context.Context, name string, p Preconditions) (io.ReadCloser, Files, error) {
+	_, body, fls, err := c.get(ctx, name, p)
+	return body, fls, err
+}
+
+// get gets file or directory name meeting p returning its response
+func (c *Client) get(ctx context.Context, name string, p Preconditions) (*http.Response, io.ReadCloser, Files, error) {
+	resp, body, err := c.getBody(ctx, name, p)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if resp.Header.Get("X-Type") == "dir" {
+		defer body.Close()
+		fls := Files{}
+		err = json.NewDecoder(body).Decode(&fls)
+		return resp, nil, fls, err
+	}
+	if resp.Header.Get("Content-Type") == ManifestContentType {
+		defer body.Close()
+		m, err := decodeManifest(body)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return resp, c.readChunks(ctx, m, 0), nil, nil
+	}
+
+	return resp, body, nil, nil
+}
+
+// getBody makes GET request for name and returns its response with body
+// verified against stored checksum, decrypted and decompressed
+func (c *Client) getBody(ctx context.Context, name string, p Preconditions) (*http.Response, io.ReadCloser, error) {
+	req, err := c.newRequest(ctx, "GET", name, nil)
 	if err != nil {
 		return nil, nil, err
 	}
+	p.set(req)
 	resp, err := c.do(req)
 	if err != nil {
 		return nil, nil, err
 	}
-	if resp.Header.Get("X-Type") == "dir" {
-		fls := Files{}
-		err = json.NewDecoder(resp.Body).Decode(&fls)
-		return nil, fls, err
+	body := resp.Body
+	if sum := resp.Header.Get("X-Meta-" + ChecksumMeta); sum != "" {
+		body = newVerifier(body, name, sum)
 	}
-
-	return resp.Body, nil, nil
+	e, err := c.encryptionOf(ctx, newFileInfo(resp).metaData)
+	if err != nil {
+		body.Close()
+		return nil, nil, err
+	}
+	if e != nil {
+		body = e.decrypt(body, name, 0)
+	}
+	if enc := resp.Header.Get("X-Meta-" + EncodingMeta); enc != "" {
+		zr, err := decompress(body, enc)
+		if err != nil {
+			body.Close()
+			return nil, nil, err
+		}
+		body = zr
+	}
+	return resp, body, nil
 }
 
 // CreateFile makes PUT request to create a resource
 func (c *Client) CreateFile(name string, fi *FileInfo, read io.Reader) (err error) {
-	req, err := c.newRequest("PUT", name, read)
+	return c.CreateFileContext(context.Background(), name, fi, read)
+}
+
+// CreateFileContext is like CreateFile but carries ctx
+func (c *Client) CreateFileContext(ctx context.Context, name string, fi *FileInfo, read io.Reader) (err error) {
+	return c.CreateFileIf(ctx, name, fi, read, Preconditions{})
+}
+
+// CreateFileIf is like CreateFileContext but fails unless the resource
+// meets p, like CreateOnly
+func (c *Client) CreateFileIf(ctx context.Context, name string, fi *FileInfo, read io.Reader, p Preconditions) (err error) {
+	c.invalidate(name, false)
+	if enc := c.compressionFor(ctx, fi); enc != EncodingIdentity && read != nil {
+		var tmp io.ReadSeekCloser
+		if fi, tmp, err = compress(enc, fi, read); err != nil {
+			return err
+		}
+		defer tmp.Close()
+		read = tmp
+	}
+	if c.keys != nil && read != nil {
+		if fi, read, err = c.encrypt(ctx, fi, read); err != nil {
+			return err
+		}
+	}
+	var sum string
+	var h hash.Hash
+	if c.checksum != "" && read != nil {
+		if rs, ok := read.(io.ReadSeeker); ok {
+			if sum, err = sumSeeker(c.checksum, rs); err != nil {
+				return err
+			}
+		} else if h = c.checksum.new(); h != nil {
+			// sum is known only after upload, it is set by Update
+			read = io.TeeReader(read, h)
+		}
+	}
+	req, err := c.newRequest(ctx, "PUT", name, read)
 	if err != nil {
 		return err
 	}
+	p.set(req)
 	req.Header.Add("Content-Type", fi.ContentType())
 	req.ContentLength = fi.Size
 	if fi.replicaCount > 0 {
@@ -62,65 +177,138 @@ func (c *Client) CreateFile(name string, fi *FileInfo, read io.Reader) (err erro
 	for k, v := range fi.metaData {
 		req.Header.Add("X-Meta-"+strings.Title(k), v)
 	}
-	_, err = c.do(req)
-	return err
+	if sum != "" {
+		req.Header.Set("X-Meta-"+ChecksumMeta, sum)
+	}
+	if err = c.doClose(req); err != nil || h == nil {
+		return err
+	}
+	return c.UpdateContext(ctx, name, map[string]string{ChecksumMeta: formatChecksum(c.checksum, h)}, nil)
 }
 
 // CreateDir makes PUT request to create a directory
 func (c *Client) CreateDir(name string, rep int, meta map[string]string) (err error) {
+	return c.CreateDirContext(context.Background(), name, rep, meta)
+}
+
+// CreateDirContext is like CreateDir but carries ctx
+func (c *Client) CreateDirContext(ctx context.Context, name string, rep int, meta map[string]string) (err error) {
+	return c.CreateDirIf(ctx, name, rep, meta, Preconditions{})
+}
+
+// CreateDirIf is like CreateDirContext but fails unless the resource meets
+// p, like CreateOnly
+func (c *Client) CreateDirIf(ctx context.Context, name string, rep int, meta map[string]string, p Preconditions) (err error) {
 	fi := &FileInfo{
 		replicaCount: rep,
 		contentType:  "application/x-directory",
 		metaData:     meta,
 	}
-	return c.CreateFile(name, fi, nil)
+	return c.CreateFileIf(ctx, name, fi, nil, p)
 }
 
-// Remove makes DELETE request to delete a resource
+// Remove makes DELETE request to delete a resource, removing chunks of a
+// file uploaded in chunks too. Names with ChunksSuffix are reserved for
+// chunks, a directory named like the resource with ChunksSuffix is removed
+// with it.
 func (c *Client) Remove(name string) (err error) {
-	req, err := c.newRequest("DELETE", name, nil)
+	return c.RemoveContext(context.Background(), name)
+}
+
+// RemoveContext is like Remove but carries ctx
+func (c *Client) RemoveContext(ctx context.Context, name string) (err error) {
+	return c.RemoveIf(ctx, name, Preconditions{})
+}
+
+// RemoveIf is like RemoveContext but fails unless the resource meets p
+func (c *Client) RemoveIf(ctx context.Context, name string, p Preconditions) (err error) {
+	c.invalidate(name, false)
+	req, err := c.newRequest(ctx, "DELETE", name, nil)
 	if err != nil {
 		return
 	}
-	_, err = c.do(req)
-	return err
+	p.set(req)
+	if err = c.doClose(req); err != nil || strings.HasSuffix(name, ChunksSuffix) {
+		return
+	}
+	// drop chunks of the file, or of its version uploaded in chunks
+	if err = c.RemoveAllContext(ctx, name+ChunksSuffix); errors.Is(err, ErrNotFound) {
+		err = nil
+	}
+	return
 }
 
 // RemoveAll makes DELETE request to delete a resource recursivly
 func (c *Client) RemoveAll(name string) (err error) {
-	req, err := c.newRequest("DELETE", name, nil)
+	return c.RemoveAllContext(context.Background(), name)
+}
+
+// RemoveAllContext is like RemoveAll but carries ctx
+func (c *Client) RemoveAllContext(ctx context.Context, name string) (err error) {
+	c.invalidate(name, true)
+	req, err := c.newRequest(ctx, "DELETE", name, nil)
 	if err != nil {
 		return
 	}
 	req.Header.Add("X-Remove-All", "x")
-	_, err = c.do(req)
-	return err
+	return c.doClose(req)
 }
 
-// Exist makes OPTIONS request to check resource existence
+// Exist makes OPTIONS request to check resource existence, it fails with
+// error matching ErrNotFound when the resource does not exist
 func (c *Client) Exist(name string) (err error) {
-	req, err := c.newRequest("OPTIONS", name, nil)
+	return c.ExistContext(context.Background(), name)
+}
+
+// ExistContext is like Exist but carries ctx
+func (c *Client) ExistContext(ctx context.Context, name string) (err error) {
+	req, err := c.newRequest(ctx, "OPTIONS", name, nil)
 	if err != nil {
 		return
 	}
-	_, err = c.do(req)
-	return err
+	return c.doClose(req)
+}
+
+// Exists reports whether resource name exists, errors other than
+// ErrNotFound are returned
+func (c *Client) Exists(name string) (bool, error) {
+	return c.ExistsContext(context.Background(), name)
+}
+
+// ExistsContext is like Exists but carries ctx
+func (c *Client) ExistsContext(ctx context.Context, name string) (bool, error) {
+	err := c.ExistContext(ctx, name)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
 }
 
 // Update makes POST request to change resources metadata
 func (c *Client) Update(name string, meta, rmeta map[string]string) error {
-	req, err := c.newRequest("POST", name, nil)
+	return c.UpdateContext(context.Background(), name, meta, rmeta)
+}
+
+// UpdateContext is like Update but carries ctx
+func (c *Client) UpdateContext(ctx context.Context, name string, meta, rmeta map[string]string) error {
+	return c.UpdateIf(ctx, name, meta, rmeta, Preconditions{})
+}
+
+// UpdateIf is like UpdateContext but fails unless the resource meets p
+func (c *Client) UpdateIf(ctx context.Context, name string, meta, rmeta map[string]string, p Preconditions) error {
+	c.invalidate(name, false)
+	req, err := c.newRequest(ctx, "POST", name, nil)
 	if err != nil {
 		return err
 	}
+	p.set(req)
 	for k, v := range meta {
 		req.Header.Add("X-Meta-"+strings.Title(k), v)
 	}
 	for k, v := range rmeta {
 		req.Header.Add("X-Remove-Meta-"+strings.Title(k), v)
 	}
-	_, err = c.do(req)
-	return err
+	return c.doClose(req)
 }
 
 // OpenFile opens a file to read and returns files info
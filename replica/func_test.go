@@ -96,9 +96,6 @@ func metaGen(t []tmeta, tp int) map[string]string {
 }
 
 func TestToken(t *testing.T) {
-	initServer()
-	initClient()
-
 	tk, err := client.Token()
 	if err != nil {
 		t.Fatal(err)
@@ -3,59 +3,31 @@ package replica
 import (
 	"log"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"syscall"
 	"testing"
-	"time"
+
+	"github.com/vonwenm/replica-go/replica/replicatest"
 )
 
 var (
-	disks  []string
-	userDB string
 	token  *Token
 	client *Client
-	server *exec.Cmd
+	server *replicatest.Server
 )
 
-func init() {
-	pwd, err := os.Getwd()
-	if err != nil {
-		log.Fatal(err)
-	}
-	userDB = filepath.Join(pwd, ".user.db")
-
-	disks = []string{filepath.Join(pwd, ".test1"), filepath.Join(pwd, ".test2")}
-	for _, dir := range disks {
-		os.Mkdir(dir, 0777)
-	}
+func TestMain(m *testing.M) {
+	initServer()
+	initClient()
+	code := m.Run()
+	cleanUp()
+	os.Exit(code)
 }
 
 func initServer() {
-	f, err := os.Create(userDB)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer f.Close()
-	_, err = f.WriteString(`{"test":"secret"}`)
-	if err != nil {
-		log.Fatal(err)
-	}
-	repPath, err := exec.LookPath("replica")
-	if err != nil {
-		log.Fatal(err)
-	}
-	server = exec.Command(repPath,
-		"-addr", "localhost:7881", "-user-db", userDB, disks[0], disks[1])
-	err = server.Start()
-	if err != nil {
-		log.Fatal(err)
-	}
-	time.Sleep(time.Millisecond * 200)
+	server = replicatest.NewServer(map[string]string{"test": "secret"})
 }
 
 func initClient() {
-	clt, err := NewClient("")
+	clt, err := NewClient(server.URL)
 	if err != nil {
 		cleanUp()
 		log.Fatal(err)
@@ -65,27 +37,25 @@ func initClient() {
 		cleanUp()
 		log.Fatal(err)
 	}
-	client, err = NewClient("", AssignToken(token.String()))
+	client, err = NewClient(server.URL, AssignToken(token.String()))
 	if err != nil {
 		cleanUp()
 		log.Fatal(err)
 	}
 }
 
-func cleanUp() {
-	err := server.Process.Signal(syscall.SIGTERM)
+// newTestClient returns a client of a fresh server closed with the test
+func newTestClient(t *testing.T, opts ...func(*Client)) (*Client, *replicatest.Server) {
+	srv := replicatest.NewServer(map[string]string{"test": "secret"})
+	t.Cleanup(srv.Close)
+	opts = append([]func(*Client){AssignCredentials("test", "secret")}, opts...)
+	clt, err := NewClient(srv.URL, opts...)
 	if err != nil {
-		log.Println(err)
-	}
-	for _, dir := range disks {
-		err := os.RemoveAll(dir)
-		if err != nil {
-			log.Println(err)
-		}
+		t.Fatal(err)
 	}
-	os.Remove(userDB)
+	return clt, srv
 }
 
-func TestCleanUP(t *testing.T) {
-	cleanUp()
+func cleanUp() {
+	server.Close()
 }
@@ -0,0 +1,145 @@
+package replica
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// maxLimitedRead caps single read of a limited body, so waits stay short
+const maxLimitedRead = 32 << 10
+
+// Limiter is a token bucket limiting bandwidth of transfers sharing it,
+// the zero value does not limit
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second, 0 is unlimited
+	tokens float64 // bytes allowed right away, negative when in debt
+	last   time.Time
+}
+
+// NewLimiter returns Limiter allowing bytesPerSec, with bursts of one
+// second worth of bytes
+func NewLimiter(bytesPerSec int64) *Limiter {
+	l := &Limiter{}
+	l.SetLimit(bytesPerSec)
+	return l
+}
+
+// SetLimit changes the limit to bytesPerSec, zero or negative removes it.
+// The change applies to transfers in progress, except ones started while
+// neither their limiter nor the client limited them.
+func (l *Limiter) SetLimit(bytesPerSec int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+	l.rate = float64(bytesPerSec)
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+}
+
+// Limit returns the limit in bytes per second, 0 when unlimited
+func (l *Limiter) Limit() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(l.rate)
+}
+
+// wait blocks until transfer of n bytes fits the limit
+func (l *Limiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	if l.rate == 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.rate {
+			l.tokens = l.rate
+		}
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	d := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// BandwidthLimit limits transfers of all requests of the client to
+// bytesPerSec in total
+func BandwidthLimit(bytesPerSec int64) func(*Client) {
+	return func(c *Client) {
+		c.limit.SetLimit(bytesPerSec)
+	}
+}
+
+// SetBandwidthLimit changes limit of the client set by BandwidthLimit
+func (c *Client) SetBandwidthLimit(bytesPerSec int64) {
+	c.limit.SetLimit(bytesPerSec)
+}
+
+type limiterKey struct{}
+
+// WithLimiter returns copy of ctx limiting transfers of requests made
+// with it by l, in addition to the limit of the client
+func WithLimiter(ctx context.Context, l *Limiter) context.Context {
+	return context.WithValue(ctx, limiterKey{}, l)
+}
+
+// limitBody returns r limited by limiter of ctx and the client, or r itself
+// when none of them limits
+func (c *Client) limitBody(ctx context.Context, r io.ReadCloser) io.ReadCloser {
+	l, _ := ctx.Value(limiterKey{}).(*Limiter)
+	lr := &limitedReader{ReadCloser: r, ctx: ctx, limits: [2]*Limiter{l, &c.limit}}
+	if !lr.limited() {
+		return r
+	}
+	return lr
+}
+
+type limitedReader struct {
+	io.ReadCloser
+	ctx    context.Context
+	limits [2]*Limiter // per transfer, may be nil, and of the client
+}
+
+// limited reports whether any of the limiters limits
+func (r *limitedReader) limited() bool {
+	for _, l := range r.limits {
+		if l != nil && l.Limit() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > maxLimitedRead && r.limited() {
+		p = p[:maxLimitedRead]
+	}
+	n, err := r.ReadCloser.Read(p)
+	for _, l := range r.limits {
+		if l == nil || n == 0 {
+			continue
+		}
+		if werr := l.wait(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,93 @@
+package replica
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(100000)
+	start := time.Now()
+	for i := 0; i < 30; i++ {
+		if err := l.wait(context.Background(), 1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 250*time.Millisecond {
+		t.Errorf("expected 30000 bytes to take about 300ms, took %v", d)
+	}
+
+	l.SetLimit(0)
+	start = time.Now()
+	l.wait(context.Background(), 1<<30)
+	if d := time.Since(start); d > 10*time.Millisecond {
+		t.Errorf("expected no wait without limit, took %v", d)
+	}
+
+	l.SetLimit(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.wait(ctx, 1000); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestBandwidthLimit(t *testing.T) {
+	clt, _ := newTestClient(t, BandwidthLimit(50000))
+	data := randomData(10000)
+
+	start := time.Now()
+	if err := clt.CreateFile("public/f", &FileInfo{Size: 10000}, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Errorf("expected upload to take about 200ms, took %v", d)
+	}
+
+	start = time.Now()
+	rc, _, err := clt.Get("public/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, _ := io.ReadAll(rc)
+	rc.Close()
+	if !bytes.Equal(buf, data) {
+		t.Error("downloaded content differs")
+	}
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Errorf("expected download to take about 200ms, took %v", d)
+	}
+
+	clt.SetBandwidthLimit(0)
+	ctx := WithLimiter(context.Background(), NewLimiter(50000))
+	start = time.Now()
+	rc, _, err = clt.GetContext(ctx, "public/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, rc)
+	rc.Close()
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Errorf("expected transfer limit to apply, took %v", d)
+	}
+
+	// bodies are left alone without limits, and reads are capped only
+	// while limited
+	body := io.NopCloser(bytes.NewReader(randomData(3 * maxLimitedRead)))
+	if r := clt.limitBody(context.Background(), body); r != body {
+		t.Errorf("expected body unchanged without limits, got %T", r)
+	}
+	l := NewLimiter(1 << 30)
+	r := clt.limitBody(WithLimiter(context.Background(), l), body)
+	buf = make([]byte, 2*maxLimitedRead)
+	if n, _ := r.Read(buf); n != maxLimitedRead {
+		t.Errorf("expected limited read of %d bytes, got %d", maxLimitedRead, n)
+	}
+	l.SetLimit(0)
+	if n, _ := r.Read(buf); n != len(buf) {
+		t.Errorf("expected unlimited read of %d bytes, got %d", len(buf), n)
+	}
+}
@@ -0,0 +1,79 @@
+package replica
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// secretHeaders are request headers carrying credentials, their values
+// are never logged nor included in errors
+var secretHeaders = []string{"X-Auth-Token", "X-Auth-Password"}
+
+const redacted = "REDACTED"
+
+// Logger makes client log every request with l at level, and failed
+// requests at the next higher level, like slog.LevelWarn for
+// slog.LevelInfo. Request headers are logged too when l is enabled for
+// slog.LevelDebug. Credentials and tokens are redacted.
+func Logger(l *slog.Logger, level slog.Level) func(*Client) {
+	return func(c *Client) {
+		c.logger = l
+		c.logLevel = level
+	}
+}
+
+// logRequest logs req which ended with resp and err after d and attempts
+func (c *Client) logRequest(req *http.Request, resp *http.Response, err error, d time.Duration, attempts int, sent int64) {
+	ctx := req.Context()
+	level := c.logLevel
+	if err != nil {
+		level += slog.LevelWarn - slog.LevelInfo
+	}
+	if !c.logger.Enabled(ctx, level) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("path", c.remotePath(req.URL)),
+		slog.Duration("duration", d),
+		slog.Int64("sent", sent),
+	}
+	if resp != nil {
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+		if err == nil && resp.ContentLength >= 0 {
+			attrs = append(attrs, slog.Int64("received", resp.ContentLength))
+		}
+	}
+	if attempts > 1 {
+		attrs = append(attrs, slog.Int("attempts", attempts))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", redact(err.Error(), req)))
+	}
+	if c.logger.Enabled(ctx, slog.LevelDebug) {
+		var hs []any
+		for k, v := range req.Header {
+			value := strings.Join(v, ", ")
+			for _, s := range secretHeaders {
+				if http.CanonicalHeaderKey(k) == s {
+					value = redacted
+				}
+			}
+			hs = append(hs, slog.String(k, value))
+		}
+		attrs = append(attrs, slog.Group("headers", hs...))
+	}
+	c.logger.LogAttrs(ctx, level, "replica request", attrs...)
+}
+
+// redact replaces values of secret headers of req in s
+func redact(s string, req *http.Request) string {
+	for _, h := range secretHeaders {
+		if v := req.Header.Get(h); v != "" {
+			s = strings.ReplaceAll(s, v, redacted)
+		}
+	}
+	return s
+}
@@ -0,0 +1,68 @@
+package replica
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	clt, _ := newTestClient(t, Logger(l, slog.LevelInfo))
+	if err := clt.CreateFile("public/f", &FileInfo{Size: 4}, strings.NewReader("data")); err != nil {
+		t.Fatal(err)
+	}
+	clt.GetInfo("public/none")
+
+	out := buf.String()
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 log lines, got %s", out)
+	}
+	for i, want := range []string{
+		`"level":"INFO","msg":"replica request","method":"GET","path":"token"`,
+		`"level":"INFO","msg":"replica request","method":"PUT","path":"public/f"`,
+		`"level":"WARN","msg":"replica request","method":"HEAD","path":"public/none"`,
+	} {
+		if !strings.Contains(lines[i], want) {
+			t.Errorf("expected %s in %s", want, lines[i])
+		}
+	}
+	for _, want := range []string{`"sent":4,"status":201`, `"status":404`, `"error":"HEAD public/none: http error`, `"X-Auth-Password":"REDACTED"`, `"X-Auth-Token":"REDACTED"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in %s", want, out)
+		}
+	}
+	if strings.Contains(out, "secret") || strings.Contains(out, clt.token.String()) {
+		t.Errorf("credentials logged: %s", out)
+	}
+
+	buf.Reset()
+	quiet := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	clt.logger = quiet
+	clt.logLevel = slog.LevelDebug
+	clt.Exist("public")
+	clt.Exist("public/none")
+	if out := buf.String(); strings.Count(out, "\n") != 1 || !strings.Contains(out, `"level":"INFO"`) || strings.Contains(out, "headers") {
+		t.Errorf("expected single failure without headers, got %s", out)
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad token "+r.Header.Get("X-Auth-Token"), http.StatusBadRequest)
+	}))
+	defer ts.Close()
+	clt, err := NewClient(ts.URL, AssignToken("tok123"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = clt.Exist("f")
+	if err == nil || strings.Contains(err.Error(), "tok123") || !strings.Contains(err.Error(), "bad token REDACTED") {
+		t.Errorf("expected redacted error, got %v", err)
+	}
+}
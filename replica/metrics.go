@@ -0,0 +1,235 @@
+package replica
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are upper bounds in seconds of latency histogram buckets
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// OperationStats are metrics of requests of one operation
+type OperationStats struct {
+	// Requests counts requests by final response status, 0 counts
+	// requests failed without response
+	Requests      map[int]int64
+	Retries       int64 // attempts repeating a failed one
+	BytesSent     int64 // of request bodies
+	BytesReceived int64 // of response bodies read
+	Latency       Histogram
+}
+
+// Histogram counts observations by value
+type Histogram struct {
+	Bounds []float64 // upper bounds of buckets
+	Counts []int64   // per bucket, the last one counts values above all bounds
+	Count  int64
+	Sum    float64
+}
+
+// observe counts value v
+func (h *Histogram) observe(v float64) {
+	if h.Counts == nil {
+		h.Bounds = latencyBuckets
+		h.Counts = make([]int64, len(latencyBuckets)+1)
+	}
+	h.Counts[sort.SearchFloat64s(h.Bounds, v)]++
+	h.Count++
+	h.Sum += v
+}
+
+// metrics of requests by operation
+type metrics struct {
+	mu  sync.Mutex
+	ops map[string]*OperationStats
+}
+
+// op returns stats of operation name, m.mu must be held
+func (m *metrics) op(name string) *OperationStats {
+	if m.ops == nil {
+		m.ops = make(map[string]*OperationStats)
+	}
+	s := m.ops[name]
+	if s == nil {
+		s = &OperationStats{Requests: make(map[int]int64)}
+		m.ops[name] = s
+	}
+	return s
+}
+
+// request counts request of operation name which ended with resp and err
+// after d and retries repeated attempts, sending sent bytes
+func (m *metrics) request(name string, resp *http.Response, err error, d time.Duration, retries int, sent int64) {
+	code := 0
+	var herr *HTTPError
+	switch {
+	case errors.As(err, &herr):
+		code = herr.Code
+	case err == nil:
+		code = resp.StatusCode
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.op(name)
+	s.Requests[code]++
+	s.Retries += int64(retries)
+	s.BytesSent += sent
+	s.Latency.observe(d.Seconds())
+}
+
+func (m *metrics) received(name string, n int) {
+	m.mu.Lock()
+	m.op(name).BytesReceived += int64(n)
+	m.mu.Unlock()
+}
+
+// operation returns name of operation req belongs to
+func (c *Client) operation(req *http.Request) string {
+	switch req.Method {
+	case "HEAD":
+		return "GetInfo"
+	case "GET":
+		if strings.TrimPrefix(req.URL.Path, urlRoot(c.addr)) == "/token" {
+			return "Token"
+		}
+		return "Get"
+	case "PUT":
+		if req.Header.Get("Content-Type") == "application/x-directory" {
+			return "CreateDir"
+		}
+		return "CreateFile"
+	case "POST":
+		return "Update"
+	case "DELETE":
+		if req.Header.Get("X-Remove-All") != "" {
+			return "RemoveAll"
+		}
+		return "Remove"
+	case "OPTIONS":
+		return "Exist"
+	}
+	return req.Method
+}
+
+// countedBody counts bytes read from response body of operation op
+type countedBody struct {
+	io.ReadCloser
+	m  *metrics
+	op string
+}
+
+func (b *countedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.m.received(b.op, n)
+	}
+	return n, err
+}
+
+// sentBody counts bytes read from request body into n
+type sentBody struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (b *sentBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
+
+// Stats returns snapshot of metrics of requests made by the client by
+// operation: GetInfo, Get, CreateFile, CreateDir, Update, Remove,
+// RemoveAll, Exist and Token. Reads of ranges and chunks count as Get,
+// latency is the time until response headers including retries.
+func (c *Client) Stats() map[string]OperationStats {
+	c.stats.mu.Lock()
+	defer c.stats.mu.Unlock()
+	stats := make(map[string]OperationStats, len(c.stats.ops))
+	for name, s := range c.stats.ops {
+		cp := *s
+		cp.Requests = make(map[int]int64, len(s.Requests))
+		for code, n := range s.Requests {
+			cp.Requests[code] = n
+		}
+		cp.Latency.Counts = append([]int64(nil), s.Latency.Counts...)
+		stats[name] = cp
+	}
+	return stats
+}
+
+// MetricsHandler returns http.Handler serving Stats of the client in
+// Prometheus text exposition format
+func (c *Client) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, c.Stats())
+	})
+}
+
+// writeMetrics writes stats in Prometheus text format to w
+func writeMetrics(w io.Writer, stats map[string]OperationStats) error {
+	ops := make([]string, 0, len(stats))
+	for op := range stats {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	bw := bufio.NewWriter(w)
+	header := func(name, typ, help string) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	header("replica_client_requests_total", "counter", "Requests by operation and response status.")
+	for _, op := range ops {
+		codes := make([]int, 0, len(stats[op].Requests))
+		for code := range stats[op].Requests {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			label := strconv.Itoa(code)
+			if code == 0 {
+				label = "error"
+			}
+			fmt.Fprintf(bw, "replica_client_requests_total{op=%q,code=%q} %d\n", op, label, stats[op].Requests[code])
+		}
+	}
+	counters := []struct {
+		name, help string
+		value      func(OperationStats) int64
+	}{
+		{"replica_client_retries_total", "Repeated attempts of failed requests.", func(s OperationStats) int64 { return s.Retries }},
+		{"replica_client_sent_bytes_total", "Bytes of request bodies sent.", func(s OperationStats) int64 { return s.BytesSent }},
+		{"replica_client_received_bytes_total", "Bytes of response bodies received.", func(s OperationStats) int64 { return s.BytesReceived }},
+	}
+	for _, ct := range counters {
+		header(ct.name, "counter", ct.help)
+		for _, op := range ops {
+			fmt.Fprintf(bw, "%s{op=%q} %d\n", ct.name, op, ct.value(stats[op]))
+		}
+	}
+
+	const hist = "replica_client_request_duration_seconds"
+	header(hist, "histogram", "Latency of requests until response headers.")
+	for _, op := range ops {
+		h := stats[op].Latency
+		var n int64
+		for i, b := range h.Bounds {
+			n += h.Counts[i]
+			fmt.Fprintf(bw, "%s_bucket{op=%q,le=%q} %d\n", hist, op, strconv.FormatFloat(b, 'g', -1, 64), n)
+		}
+		fmt.Fprintf(bw, "%s_bucket{op=%q,le=\"+Inf\"} %d\n", hist, op, h.Count)
+		fmt.Fprintf(bw, "%s_sum{op=%q} %s\n", hist, op, strconv.FormatFloat(h.Sum, 'g', -1, 64))
+		fmt.Fprintf(bw, "%s_count{op=%q} %d\n", hist, op, h.Count)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,96 @@
+package replica
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	clt, _ := newTestClient(t)
+	if err := clt.CreateFile("public/f", &FileInfo{Size: 1000}, bytes.NewReader(randomData(1000))); err != nil {
+		t.Fatal(err)
+	}
+	readAll(t, clt, "public/f")
+	clt.GetInfo("public/none")
+	if err := clt.Remove("public/f"); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := clt.Stats()
+	tests := []struct {
+		op             string
+		code           int
+		sent, received int64
+	}{
+		{"Token", 200, 0, -1},
+		{"CreateFile", 201, 1000, 0},
+		{"Get", 200, 0, 1000},
+		{"GetInfo", 404, 0, 0},
+		{"Remove", 200, 0, 0},
+		// Remove drops chunks of the file if any
+		{"RemoveAll", 404, 0, 0},
+	}
+	for _, tt := range tests {
+		s, ok := stats[tt.op]
+		if !ok {
+			t.Errorf("%s: no stats", tt.op)
+			continue
+		}
+		if len(s.Requests) != 1 || s.Requests[tt.code] != 1 || s.Retries != 0 {
+			t.Errorf("%s: unexpected requests %v and retries %d", tt.op, s.Requests, s.Retries)
+		}
+		if s.BytesSent != tt.sent || tt.received >= 0 && s.BytesReceived != tt.received {
+			t.Errorf("%s: unexpected bytes sent %d and received %d", tt.op, s.BytesSent, s.BytesReceived)
+		}
+		if s.Latency.Count != 1 || s.Latency.Sum <= 0 || len(s.Latency.Counts) != len(s.Latency.Bounds)+1 {
+			t.Errorf("%s: unexpected latency %+v", tt.op, s.Latency)
+		}
+	}
+	stats["Get"].Requests[200] = 7
+	if clt.Stats()["Get"].Requests[200] != 1 {
+		t.Error("snapshot shares state with the client")
+	}
+
+	rec := httptest.NewRecorder()
+	clt.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE replica_client_requests_total counter",
+		`replica_client_requests_total{op="GetInfo",code="404"} 1`,
+		`replica_client_sent_bytes_total{op="CreateFile"} 1000`,
+		`replica_client_received_bytes_total{op="Get"} 1000`,
+		`replica_client_retries_total{op="Remove"} 0`,
+		"# TYPE replica_client_request_duration_seconds histogram",
+		`replica_client_request_duration_seconds_bucket{op="Get",le="+Inf"} 1`,
+		`replica_client_request_duration_seconds_bucket{op="Get",le="10"} 1`,
+		`replica_client_request_duration_seconds_count{op="Get"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected line %s in\n%s", line, body)
+		}
+	}
+}
+
+func TestStatsRetries(t *testing.T) {
+	srv := &flakyServer{fails: 2, code: 503}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	clt, _ := NewClient(ts.URL, AssignRetryPolicy(testRetryPolicy))
+	if err := clt.CreateFile("f", &FileInfo{Size: 4}, strings.NewReader("data")); err != nil {
+		t.Fatal(err)
+	}
+	srv.Lock()
+	srv.fails, srv.code = srv.hits+10, 0
+	srv.Unlock()
+	clt.Exist("f")
+
+	stats := clt.Stats()
+	if s := stats["CreateFile"]; s.Requests[200] != 1 || s.Retries != 2 || s.BytesSent != 12 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	if s := stats["Exist"]; s.Requests[0] != 1 || s.Retries != 2 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
@@ -0,0 +1,71 @@
+package replica
+
+import (
+	"net/http"
+)
+
+// RoundTripFunc is a function implementing http.RoundTripper
+type RoundTripFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper
+func (f RoundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// Middleware wraps round tripper next, which sends requests of the client
+// over the network, adding behaviour around every attempt of a request
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// HTTPClient makes client send requests with hc, its transport is wrapped
+// with middleware of the client and AllowUnsignedSSL does not apply to it
+func HTTPClient(hc *http.Client) func(*Client) {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// Transport makes client send requests with rt instead of transport of
+// its http client, AllowUnsignedSSL does not apply to it
+func Transport(rt http.RoundTripper) func(*Client) {
+	return func(c *Client) {
+		c.transport = rt
+	}
+}
+
+// Use appends mw to middleware of the client. Middleware applies to every
+// request sent including token requests, retries and health checks, the
+// first added is the outermost.
+func Use(mw ...Middleware) func(*Client) {
+	return func(c *Client) {
+		c.middleware = append(c.middleware, mw...)
+	}
+}
+
+// BeforeRequest returns Middleware calling fn with a copy of every request
+// before it is sent, fn may change its headers. Error of fn fails the
+// request.
+func BeforeRequest(fn func(*http.Request) error) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			if err := fn(req); err != nil {
+				if req.Body != nil {
+					req.Body.Close()
+				}
+				return nil, err
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// AfterResponse returns Middleware calling fn with every request and its
+// response or error once it is received, fn must not read the response
+// body
+func AfterResponse(fn func(req *http.Request, resp *http.Response, err error)) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.RoundTrip(req)
+			fn(req, resp, err)
+			return resp, err
+		})
+	}
+}
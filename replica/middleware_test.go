@@ -0,0 +1,73 @@
+package replica
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	_, srv := newTestClient(t)
+	var mu sync.Mutex
+	var traced, seen []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traced = append(traced, r.Header.Get("X-Trace-Id"))
+		mu.Unlock()
+		srv.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	var order []string
+	var sent int
+	hc := &http.Client{}
+	clt, err := NewClient(ts.URL, AssignCredentials("test", "secret"), HTTPClient(hc),
+		Transport(RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			sent++
+			return http.DefaultTransport.RoundTrip(req)
+		})),
+		Use(BeforeRequest(func(req *http.Request) error {
+			order = append(order, "outer")
+			req.Header.Set("X-Trace-Id", "t1")
+			return nil
+		}), BeforeRequest(func(req *http.Request) error {
+			order = append(order, "inner")
+			return nil
+		})),
+		Use(AfterResponse(func(req *http.Request, resp *http.Response, err error) {
+			if err == nil {
+				seen = append(seen, req.Method+" "+req.URL.Path+" "+resp.Status)
+			}
+		})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clt.Exists("public/f"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"GET /token 200 OK", "OPTIONS /json/public/f 404 Not Found"}
+	if strings.Join(seen, ",") != strings.Join(want, ",") {
+		t.Errorf("expected %q, got %q", want, seen)
+	}
+	if strings.Join(order, ",") != "outer,inner,outer,inner" {
+		t.Errorf("unexpected order %q", order)
+	}
+	if strings.Join(traced, ",") != "t1,t1" || sent != 2 {
+		t.Errorf("expected 2 traced requests, got %q and %d", traced, sent)
+	}
+	if hc.Transport != nil {
+		t.Error("http client of caller was changed")
+	}
+
+	errStop := errors.New("stop")
+	clt, err = NewClient(ts.URL, AssignToken("x"), Use(BeforeRequest(func(*http.Request) error { return errStop })))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := clt.Exist("public"); !errors.Is(err, errStop) {
+		t.Errorf("expected stop, got %v", err)
+	}
+}
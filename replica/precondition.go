@@ -0,0 +1,49 @@
+package replica
+
+import (
+	"net/http"
+	"time"
+)
+
+// Preconditions are conditions a resource must meet for a request to
+// proceed, zero fields are not checked. IfMatch and IfUnmodifiedSince
+// apply to PUT, POST and DELETE requests and fail them with
+// ErrPreconditionFailed, IfModifiedSince applies to GET and HEAD requests
+// and fails them with ErrNotModified. IfNoneMatch applies to all of them,
+// "*" matches any existing resource. Preconditions are passed to the If
+// variants of operations, requests made on behalf of the one asked for,
+// like chunk uploads or range reads of a downloaded file, are not
+// conditional.
+type Preconditions struct {
+	IfMatch           string // ETag the resource must have
+	IfNoneMatch       string // ETag the resource must not have
+	IfModifiedSince   time.Time
+	IfUnmodifiedSince time.Time
+}
+
+// CreateOnly are Preconditions making CreateFileIf and CreateDirIf fail
+// with ErrPreconditionFailed when the resource exists
+var CreateOnly = Preconditions{IfNoneMatch: "*"}
+
+// set sets headers of preconditions applying to req
+func (p Preconditions) set(req *http.Request) {
+	if p.IfNoneMatch != "" {
+		req.Header.Set("If-None-Match", p.IfNoneMatch)
+	}
+	switch req.Method {
+	case "GET", "HEAD":
+		if !p.IfModifiedSince.IsZero() {
+			req.Header.Set("If-Modified-Since", p.IfModifiedSince.UTC().Format(http.TimeFormat))
+		}
+	case "PUT", "POST", "DELETE":
+		if p.IfMatch != "" {
+			req.Header.Set("If-Match", p.IfMatch)
+		}
+		if !p.IfUnmodifiedSince.IsZero() {
+			req.Header.Set("If-Unmodified-Since", p.IfUnmodifiedSince.UTC().Format(http.TimeFormat))
+		}
+	}
+}
+
+// ETag returns entity tag of f reported by the server
+func (f *FileInfo) ETag() string { return f.etag }
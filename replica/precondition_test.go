@@ -0,0 +1,123 @@
+package replica
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreconditions(t *testing.T) {
+	clt, _ := newTestClient(t)
+	ctx := context.Background()
+	create := func(p Preconditions, s string) error {
+		return clt.CreateFileIf(ctx, "public/f", &FileInfo{Size: int64(len(s))}, strings.NewReader(s), p)
+	}
+
+	if err := create(CreateOnly, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := create(CreateOnly, "second"); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expected precondition failed, got %v", err)
+	}
+	if err := clt.CreateDirIf(ctx, "public", 0, nil, CreateOnly); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expected precondition failed, got %v", err)
+	}
+	fi, err := clt.GetInfo("public/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.ETag() == "" {
+		t.Fatal("expected ETag")
+	}
+
+	// modification by another writer is detected
+	stale := Preconditions{IfMatch: fi.ETag()}
+	if err := clt.UpdateIf(ctx, "public/f", map[string]string{"Color": "red"}, nil, stale); err != nil {
+		t.Fatal(err)
+	}
+	if err := create(stale, "third"); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expected precondition failed, got %v", err)
+	}
+	if err := clt.RemoveIf(ctx, "public/f", stale); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expected precondition failed, got %v", err)
+	}
+	past := Preconditions{IfUnmodifiedSince: fi.ModTime.Add(-time.Hour)}
+	if err := clt.RemoveIf(ctx, "public/f", past); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expected precondition failed, got %v", err)
+	}
+
+	fi, _ = clt.GetInfo("public/f")
+	cached := Preconditions{IfNoneMatch: fi.ETag()}
+	if _, _, err := clt.GetIf(ctx, "public/f", cached); !errors.Is(err, ErrNotModified) {
+		t.Errorf("expected not modified, got %v", err)
+	}
+	_, err = clt.GetInfoIf(ctx, "public/f", Preconditions{IfModifiedSince: fi.ModTime})
+	if !errors.Is(err, ErrNotModified) || errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expected not modified, got %v", err)
+	}
+	rc, _, err := clt.GetIf(ctx, "public/f", Preconditions{IfModifiedSince: fi.ModTime.Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+
+	if err := create(Preconditions{IfMatch: fi.ETag()}, "fourth"); err != nil {
+		t.Fatal(err)
+	}
+	if buf := readAll(t, clt, "public/f"); string(buf) != "fourth" {
+		t.Errorf("expected fourth, got %s", buf)
+	}
+}
+
+func TestPreconditionsTransfers(t *testing.T) {
+	clt, _ := newTestClient(t, Checksum(ChecksumMD5))
+	ctx := context.Background()
+	data := randomData(2500)
+	local := filepath.Join(t.TempDir(), "big")
+	if err := os.WriteFile(local, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := &UploadOptions{ChunkSize: 1000, StateDir: t.TempDir(), Preconditions: CreateOnly}
+
+	// conditions apply to the manifest, not chunks
+	if _, err := clt.UploadFile(local, "public/big", opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clt.UploadFile(local, "public/big", opts); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expected precondition failed, got %v", err)
+	}
+	// neither to the checksum set after streamed upload
+	if err := clt.CreateFileIf(ctx, "public/s", &FileInfo{Size: 4}, strings.NewReader("data"), CreateOnly); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := clt.GetInfo("public/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "big")
+	cached := Preconditions{IfNoneMatch: fi.ETag()}
+	if _, err := clt.DownloadFile("public/big", dst, &DownloadOptions{Preconditions: cached}); !errors.Is(err, ErrNotModified) {
+		t.Errorf("expected not modified, got %v", err)
+	}
+	if _, _, err := clt.GetIf(ctx, "public/big", cached); !errors.Is(err, ErrNotModified) {
+		t.Errorf("expected not modified, got %v", err)
+	}
+	changed := Preconditions{IfNoneMatch: `"stale"`}
+	if _, err := clt.DownloadFile("public/big", dst, &DownloadOptions{Preconditions: changed}); err != nil {
+		t.Fatal(err)
+	}
+	if buf, _ := os.ReadFile(dst); !bytes.Equal(buf, data) {
+		t.Error("downloaded content differs")
+	}
+	rc, _, err := clt.GetIf(ctx, "public/big", changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+}
@@ -0,0 +1,134 @@
+package replica
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// progressInterval is the least time between two progress reports
+const progressInterval = 100 * time.Millisecond
+
+// Progress describes state of a transfer
+type Progress struct {
+	Bytes int64         // bytes transferred so far
+	Total int64         // bytes expected, 0 when unknown
+	Rate  float64       // average bytes per second
+	ETA   time.Duration // estimated time left, 0 when unknown
+}
+
+// ProgressFunc is called with progress of a transfer, it is called
+// serially and should not block
+type ProgressFunc func(Progress)
+
+// ProgressChan returns ProgressFunc sending progress to ch, reports are
+// dropped while ch is full
+func ProgressChan(ch chan<- Progress) ProgressFunc {
+	return func(p Progress) {
+		select {
+		case ch <- p:
+		default:
+		}
+	}
+}
+
+type progressKey struct{}
+
+// WithProgress returns copy of ctx reporting to fn progress of request and
+// response bodies transferred by requests made with it. Bytes and totals of
+// all such requests add up, so a single context can track a transfer made
+// of several requests.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, newTracker(fn, 0))
+}
+
+// withoutProgress returns copy of ctx not reporting progress, for requests
+// not being part of transferred content
+func withoutProgress(ctx context.Context) context.Context {
+	if progressFrom(ctx) == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressKey{}, (*tracker)(nil))
+}
+
+func progressFrom(ctx context.Context) *tracker {
+	t, _ := ctx.Value(progressKey{}).(*tracker)
+	return t
+}
+
+// tracker sums progress of bodies it wraps
+type tracker struct {
+	fn    ProgressFunc
+	fixed bool // total was given upfront
+
+	mu    sync.Mutex // guards fields below
+	start time.Time
+	last  time.Time
+	bytes int64
+	total int64
+}
+
+// newTracker returns tracker reporting to fn, positive total is fixed
+// total of the whole transfer
+func newTracker(fn ProgressFunc, total int64) *tracker {
+	return &tracker{fn: fn, fixed: total > 0, total: total, start: time.Now()}
+}
+
+// wrap returns r counting bytes read into t, n is length of r or -1
+func (t *tracker) wrap(r io.ReadCloser, n int64) *progressReader {
+	if n > 0 && !t.fixed {
+		t.mu.Lock()
+		t.total += n
+		t.mu.Unlock()
+	}
+	return &progressReader{ReadCloser: r, t: t, size: n}
+}
+
+// add counts n bytes transferred, reporting when due or when final is set
+func (t *tracker) add(n int64, final bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.bytes += n
+	now := time.Now()
+	if !final && now.Sub(t.last) < progressInterval && (t.total == 0 || t.bytes < t.total) {
+		return
+	}
+	t.last = now
+	p := Progress{Bytes: t.bytes, Total: t.total}
+	if d := now.Sub(t.start).Seconds(); d > 0 {
+		p.Rate = float64(t.bytes) / d
+	}
+	if p.Rate > 0 && p.Total > p.Bytes {
+		p.ETA = time.Duration(float64(p.Total-p.Bytes) / p.Rate * float64(time.Second))
+	}
+	t.fn(p)
+}
+
+type progressReader struct {
+	io.ReadCloser
+	t    *tracker
+	size int64 // length of body or -1
+	n    int64 // bytes read
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 || err == io.EOF {
+		r.n += int64(n)
+		r.t.add(int64(n), err == io.EOF)
+	}
+	return n, err
+}
+
+// undo takes back bytes read and the length of r from its tracker, when
+// attempt to send r failed
+func (r *progressReader) undo() {
+	r.t.mu.Lock()
+	if r.size > 0 && !r.t.fixed {
+		r.t.total -= r.size
+	}
+	r.t.bytes -= r.n
+	r.t.mu.Unlock()
+	r.n = 0
+}
@@ -0,0 +1,115 @@
+package replica
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// progressLog records progress reports
+type progressLog struct {
+	sync.Mutex
+	reports []Progress
+}
+
+func (l *progressLog) report(p Progress) {
+	l.Lock()
+	l.reports = append(l.reports, p)
+	l.Unlock()
+}
+
+func (l *progressLog) last(t *testing.T) Progress {
+	l.Lock()
+	defer l.Unlock()
+	if len(l.reports) == 0 {
+		t.Fatal("no progress reported")
+	}
+	return l.reports[len(l.reports)-1]
+}
+
+func TestProgress(t *testing.T) {
+	clt, _ := newTestClient(t)
+	data := randomData(3000)
+	log := &progressLog{}
+	ctx := WithProgress(context.Background(), log.report)
+	if err := clt.CreateFileContext(ctx, "public/big", &FileInfo{Size: 3000}, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if p := log.last(t); p.Bytes != 3000 || p.Total != 3000 || p.ETA != 0 {
+		t.Errorf("unexpected upload progress %+v", p)
+	}
+
+	log = &progressLog{}
+	rc, _, err := clt.GetContext(WithProgress(context.Background(), log.report), "public/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, rc)
+	rc.Close()
+	if p := log.last(t); p.Bytes != 3000 || p.Total != 3000 {
+		t.Errorf("unexpected download progress %+v", p)
+	}
+}
+
+func TestProgressRetry(t *testing.T) {
+	srv := &flakyServer{fails: 1, code: 503}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	clt, _ := NewClient(ts.URL, AssignRetryPolicy(testRetryPolicy))
+	log := &progressLog{}
+	ctx := WithProgress(context.Background(), log.report)
+	if err := clt.CreateFileContext(ctx, "f", &FileInfo{Size: 4}, strings.NewReader("data")); err != nil {
+		t.Fatal(err)
+	}
+	// bytes of the failed attempt are taken back
+	if p := log.last(t); p.Bytes != 4 || p.Total != 4 {
+		t.Errorf("unexpected progress %+v", p)
+	}
+}
+
+func TestTreeProgress(t *testing.T) {
+	clt, _ := newTestClient(t)
+	src := t.TempDir()
+	writeTree(t, src, testTree)
+	var total int64
+	for _, data := range testTree {
+		total += int64(len(data))
+	}
+
+	log := &progressLog{}
+	if _, err := clt.UploadTree(src, "public/tree", &UploadOptions{Progress: log.report}); err != nil {
+		t.Fatal(err)
+	}
+	if p := log.last(t); p.Bytes != total || p.Total != total {
+		t.Errorf("unexpected upload progress %+v, total %d", p, total)
+	}
+
+	log = &progressLog{}
+	dst := filepath.Join(t.TempDir(), "dst")
+	if _, err := clt.DownloadTree("public/tree", dst, &DownloadOptions{Progress: log.report}); err != nil {
+		t.Fatal(err)
+	}
+	if p := log.last(t); p.Bytes != total || p.Total != total {
+		t.Errorf("unexpected download progress %+v, total %d", p, total)
+	}
+}
+
+func TestProgressChan(t *testing.T) {
+	ch := make(chan Progress, 1)
+	fn := ProgressChan(ch)
+	fn(Progress{Bytes: 1})
+	fn(Progress{Bytes: 2})
+	if p := <-ch; p.Bytes != 1 {
+		t.Errorf("expected first report, got %+v", p)
+	}
+	select {
+	case p := <-ch:
+		t.Errorf("expected report dropped, got %+v", p)
+	default:
+	}
+}
@@ -0,0 +1,433 @@
+// Package replicatest provides an in-memory replica server for tests.
+//
+// Server speaks the json protocol of replica server: tokens are issued by
+// the token endpoint, resources live under /json and are described by
+// X-Type, X-Path, X-Owner, X-Length, X-Replica-Count and X-Meta-* headers.
+// Resources carry an ETag changing on every modification, requests honor
+// If-Match, If-None-Match, If-Modified-Since and If-Unmodified-Since.
+// Like a fresh replica server it holds an empty public directory and
+// empty files can't be created, a PUT request without content length fails
+// with 411 Length Required.
+package replicatest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dirContentType = "application/x-directory"
+
+// Server is an in-memory replica server
+type Server struct {
+	*httptest.Server
+
+	// TokenTTL is lifetime of issued tokens, one hour by default
+	TokenTTL time.Duration
+
+	mu     sync.Mutex
+	users  map[string]string
+	tokens map[string]*token
+	root   *node
+}
+
+type token struct {
+	Token   string `json:"auth_token"`
+	Expires int64  `json:"expires"`
+	user    string
+}
+
+type node struct {
+	name         string
+	dir          bool
+	owner        string
+	contentType  string
+	replicaCount int
+	meta         map[string]string
+	data         []byte
+	modTime      time.Time
+	etag         string
+	children     map[string]*node
+}
+
+// fileInfo is the listing entry of a directory
+type fileInfo struct {
+	Name    string    `json:"name,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	Owner   string    `json:"owner,omitempty"`
+	IsDir   bool      `json:"is_dir,omitempty"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"mod_time,omitempty"`
+}
+
+// NewServer starts a server accepting users given as name to password map
+func NewServer(users map[string]string) *Server {
+	s := newServer(users)
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+func newServer(users map[string]string) *Server {
+	s := &Server{
+		TokenTTL: time.Hour,
+		users:    make(map[string]string),
+		tokens:   make(map[string]*token),
+		root:     newDir("", ""),
+	}
+	for u, p := range users {
+		s.users[u] = p
+	}
+	s.root.children["public"] = newDir("public", "")
+	return s
+}
+
+func newDir(name, owner string) *node {
+	return &node{
+		name:        name,
+		dir:         true,
+		owner:       owner,
+		contentType: dirContentType,
+		meta:        make(map[string]string),
+		modTime:     time.Now(),
+		etag:        newETag(),
+		children:    make(map[string]*node),
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		s.serveToken(w, r)
+		return
+	}
+	if r.URL.Path != "/json" && !strings.HasPrefix(r.URL.Path, "/json/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	user, ok := s.authorize(r.Header.Get("X-Auth-Token"))
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/json"), "/")
+	switch r.Method {
+	case "HEAD", "GET":
+		s.serveGet(w, r, name)
+	case "PUT":
+		s.servePut(w, r, name, user)
+	case "POST":
+		s.servePost(w, r, name)
+	case "DELETE":
+		s.serveDelete(w, r, name)
+	case "OPTIONS":
+		s.mu.Lock()
+		n := s.lookup(name)
+		s.mu.Unlock()
+		if n == nil {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		w.Header().Set("Allow", "HEAD, GET, PUT, POST, DELETE, OPTIONS")
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// authorize returns user owning valid token tk
+func (s *Server) authorize(tk string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[tk]
+	if !ok || time.Now().Unix() >= t.Expires {
+		return "", false
+	}
+	return t.user, true
+}
+
+func (s *Server) serveToken(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tk, ok := s.tokens[r.Header.Get("X-Auth-Token")]; ok && time.Now().Unix() < tk.Expires {
+		json.NewEncoder(w).Encode(tk)
+		return
+	}
+	user := r.Header.Get("X-Auth-User")
+	passwd, ok := s.users[user]
+	if !ok || passwd != r.Header.Get("X-Auth-Password") {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	var buf [16]byte
+	rand.Read(buf[:])
+	tk := &token{
+		Token:   hex.EncodeToString(buf[:]),
+		Expires: time.Now().Add(s.TokenTTL).Unix(),
+		user:    user,
+	}
+	s.tokens[tk.Token] = tk
+	json.NewEncoder(w).Encode(tk)
+}
+
+func (s *Server) serveGet(w http.ResponseWriter, r *http.Request, name string) {
+	s.mu.Lock()
+	n := s.lookup(name)
+	if n == nil {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	writeHeaders(w, n, name)
+	if code := checkPreconditions(r, n); code != 0 {
+		s.mu.Unlock()
+		writePreconditionFailure(w, code)
+		return
+	}
+	if !n.dir {
+		// file data is never modified in place, serve it unlocked
+		s.mu.Unlock()
+		http.ServeContent(w, r, n.name, n.modTime, bytes.NewReader(n.data))
+		return
+	}
+	defer s.mu.Unlock()
+	if r.Method == "HEAD" {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	files := []fileInfo{}
+	for _, c := range n.children {
+		files = append(files, fileInfo{
+			Name:    c.name,
+			Path:    path.Join(name, c.name),
+			Owner:   c.owner,
+			IsDir:   c.dir,
+			Size:    c.size(),
+			ModTime: c.modTime,
+		})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	json.NewEncoder(w).Encode(files)
+}
+
+func (s *Server) servePut(w http.ResponseWriter, r *http.Request, name, user string) {
+	ctype := r.Header.Get("Content-Type")
+	var data []byte
+	if ctype != dirContentType {
+		if r.ContentLength <= 0 {
+			writeError(w, http.StatusLengthRequired, "length required")
+			return
+		}
+		var err error
+		if data, err = io.ReadAll(r.Body); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if int64(len(data)) != r.ContentLength {
+			writeError(w, http.StatusBadRequest, "content length mismatch")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dir, base := path.Split(name)
+	parent := s.lookup(dir)
+	if base == "" || parent == nil || !parent.dir {
+		writeError(w, http.StatusNotFound, "parent directory not found")
+		return
+	}
+	old := parent.children[base]
+	if code := checkPreconditions(r, old); code != 0 {
+		writePreconditionFailure(w, code)
+		return
+	}
+	var n *node
+	if ctype == dirContentType {
+		if old != nil {
+			writeError(w, http.StatusConflict, "already exists")
+			return
+		}
+		n = newDir(base, user)
+	} else {
+		if old != nil && old.dir {
+			writeError(w, http.StatusConflict, "is a directory")
+			return
+		}
+		n = &node{name: base, owner: user, contentType: ctype, data: data, etag: newETag()}
+	}
+	n.modTime = time.Now()
+	n.replicaCount = 1
+	if rc, err := strconv.Atoi(r.Header.Get("X-Replica-Count")); err == nil && rc > 0 {
+		n.replicaCount = rc
+	}
+	n.meta = make(map[string]string)
+	for k, v := range r.Header {
+		if strings.HasPrefix(k, "X-Meta-") {
+			n.meta[strings.TrimPrefix(k, "X-Meta-")] = strings.Join(v, " ")
+		}
+	}
+	parent.children[base] = n
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) servePost(w http.ResponseWriter, r *http.Request, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.lookup(name)
+	if n == nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if code := checkPreconditions(r, n); code != 0 {
+		writePreconditionFailure(w, code)
+		return
+	}
+	n.etag = newETag()
+	for k, v := range r.Header {
+		switch {
+		case strings.HasPrefix(k, "X-Meta-"):
+			n.meta[strings.TrimPrefix(k, "X-Meta-")] = strings.Join(v, " ")
+		case strings.HasPrefix(k, "X-Remove-Meta-"):
+			delete(n.meta, strings.TrimPrefix(k, "X-Remove-Meta-"))
+		}
+	}
+}
+
+func (s *Server) serveDelete(w http.ResponseWriter, r *http.Request, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dir, base := path.Split(name)
+	parent := s.lookup(dir)
+	if base == "" || parent == nil || parent.children[base] == nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	n := parent.children[base]
+	if code := checkPreconditions(r, n); code != 0 {
+		writePreconditionFailure(w, code)
+		return
+	}
+	if n.dir && len(n.children) > 0 && r.Header.Get("X-Remove-All") == "" {
+		writeError(w, http.StatusConflict, "directory not empty")
+		return
+	}
+	delete(parent.children, base)
+}
+
+// lookup returns node of name or nil
+func (s *Server) lookup(name string) *node {
+	n := s.root
+	for _, p := range strings.Split(strings.Trim(name, "/"), "/") {
+		if p == "" {
+			continue
+		}
+		if !n.dir {
+			return nil
+		}
+		if n = n.children[p]; n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+func (n *node) size() int64 {
+	return int64(len(n.data))
+}
+
+func writeHeaders(w http.ResponseWriter, n *node, name string) {
+	h := w.Header()
+	h.Set("X-Path", name)
+	h.Set("X-Owner", n.owner)
+	h.Set("X-Length", strconv.FormatInt(n.size(), 10))
+	h.Set("X-Replica-Count", strconv.Itoa(n.replicaCount))
+	h.Set("Content-Type", n.contentType)
+	h.Set("Last-Modified", n.modTime.UTC().Format(http.TimeFormat))
+	h.Set("ETag", n.etag)
+	if n.dir {
+		h.Set("X-Type", "dir")
+	} else {
+		h.Set("X-Type", "file")
+	}
+	for k, v := range n.meta {
+		h.Set("X-Meta-"+k, v)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Code    int    `json:"error_code"`
+		Message string `json:"error_message"`
+	}{code, msg})
+}
+
+// newETag returns a fresh entity tag, it changes with every modification
+// of a node
+func newETag() string {
+	var buf [8]byte
+	rand.Read(buf[:])
+	return `"` + hex.EncodeToString(buf[:]) + `"`
+}
+
+// checkPreconditions returns status failing request r on node n, which is
+// nil when missing, or 0 when conditional headers of r are met
+func checkPreconditions(r *http.Request, n *node) int {
+	get := r.Method == "GET" || r.Method == "HEAD"
+	var modTime time.Time
+	if n != nil {
+		modTime = n.modTime.Truncate(time.Second)
+	}
+	if v := r.Header.Get("If-Match"); v != "" {
+		if !matchETag(v, n) {
+			return http.StatusPreconditionFailed
+		}
+	} else if t, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil && n != nil && modTime.After(t) {
+		return http.StatusPreconditionFailed
+	}
+	if v := r.Header.Get("If-None-Match"); v != "" {
+		if !matchETag(v, n) {
+			return 0
+		}
+		if get {
+			return http.StatusNotModified
+		}
+		return http.StatusPreconditionFailed
+	}
+	if t, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && get && n != nil && !modTime.After(t) {
+		return http.StatusNotModified
+	}
+	return 0
+}
+
+// matchETag reports whether list of entity tags v matches node n
+func matchETag(v string, n *node) bool {
+	if n == nil {
+		return false
+	}
+	for _, tag := range strings.Split(v, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == n.etag {
+			return true
+		}
+	}
+	return false
+}
+
+func writePreconditionFailure(w http.ResponseWriter, code int) {
+	if code == http.StatusNotModified {
+		w.WriteHeader(code)
+		return
+	}
+	writeError(w, code, "precondition failed")
+}
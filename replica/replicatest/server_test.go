@@ -0,0 +1,93 @@
+package replicatest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	srv := NewServer(map[string]string{"test": "secret"})
+	defer srv.Close()
+
+	do := func(method, p string, body io.Reader, h map[string]string) *http.Response {
+		req, err := http.NewRequest(method, srv.URL+p, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range h {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := do("GET", "/json/public", nil, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", resp.StatusCode)
+	}
+	resp = do("GET", "/token", nil, map[string]string{"X-Auth-User": "test", "X-Auth-Password": "secret"})
+	tk := &token{}
+	if err := json.NewDecoder(resp.Body).Decode(tk); err != nil || tk.Token == "" {
+		t.Fatalf("expected token, got %v %v", tk, err)
+	}
+	auth := map[string]string{"X-Auth-Token": tk.Token}
+
+	tests := []struct {
+		method, path, body string
+		header             map[string]string
+		code               int
+	}{
+		{"PUT", "/json/public/f", "data", map[string]string{"X-Meta-Color": "red", "X-Replica-Count": "2"}, 201},
+		{"PUT", "/json/public/f", "data", map[string]string{"If-None-Match": "*"}, 412},
+		{"DELETE", "/json/public/f", "", map[string]string{"If-Match": `"stale"`}, 412},
+		{"GET", "/json/public/f", "", map[string]string{"If-Modified-Since": time.Now().UTC().Format(http.TimeFormat)}, 304},
+		{"PUT", "/json/missing/f", "data", nil, 404},
+		{"PUT", "/json/public/d", "", map[string]string{"Content-Type": dirContentType}, 201},
+		{"PUT", "/json/public/d", "", map[string]string{"Content-Type": dirContentType}, 409},
+		{"PUT", "/json/public/d/e", "", map[string]string{"Content-Type": dirContentType}, 201},
+		{"PUT", "/json/public/empty", "", nil, 411},
+		{"OPTIONS", "/json/public/f", "", nil, 200},
+		{"OPTIONS", "/json/public/none", "", nil, 404},
+		{"POST", "/json/public/f", "", map[string]string{"X-Remove-Meta-Color": "x"}, 200},
+		{"DELETE", "/json/public/d", "", nil, 409},
+		{"DELETE", "/json/public/d", "", map[string]string{"X-Remove-All": "x"}, 200},
+	}
+	for _, tt := range tests {
+		h := map[string]string{"X-Auth-Token": tk.Token}
+		for k, v := range tt.header {
+			h[k] = v
+		}
+		resp := do(tt.method, tt.path, strings.NewReader(tt.body), h)
+		resp.Body.Close()
+		if resp.StatusCode != tt.code {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.code, resp.StatusCode)
+		}
+	}
+
+	resp = do("GET", "/json/public/f", nil, auth)
+	buf, _ := io.ReadAll(resp.Body)
+	if string(buf) != "data" {
+		t.Errorf("expected data, got %s", buf)
+	}
+	h := resp.Header
+	if h.Get("X-Type") != "file" || h.Get("X-Length") != "4" || h.Get("X-Owner") != "test" ||
+		h.Get("X-Replica-Count") != "2" || h.Get("X-Path") != "public/f" || h.Get("X-Meta-Color") != "" {
+		t.Errorf("unexpected headers %v", h)
+	}
+
+	resp = do("GET", "/json/public", nil, auth)
+	var files []fileInfo
+	if err := json.NewDecoder(resp.Body).Decode(&files); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Header.Get("X-Type") != "dir" || len(files) != 1 || files[0].Path != "public/f" {
+		t.Errorf("unexpected listing %+v", files)
+	}
+}
@@ -0,0 +1,197 @@
+package replica
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy describes how failed idempotent requests are retried
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry, it doubles with
+	// every following retry up to MaxBackoff. Actual delays are randomly
+	// reduced by up to a half to spread retries of concurrent clients.
+	// Delays asked for by Retry-After response headers are honoured up to
+	// MaxBackoff too.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// StatusCodes lists response codes considered transient
+	StatusCodes []int
+}
+
+// DefaultRetryPolicy retries connection errors and gateway failures
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	MinBackoff:  100 * time.Millisecond,
+	MaxBackoff:  5 * time.Second,
+	StatusCodes: []int{
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+}
+
+// AssignRetryPolicy set policy used to retry idempotent requests
+func AssignRetryPolicy(p RetryPolicy) func(*Client) {
+	return func(c *Client) {
+		c.retry = &p
+	}
+}
+
+// retryable reports whether the failed attempt of req may be repeated
+func (p *RetryPolicy) retryable(req *http.Request, err error) bool {
+	if !repeatable(req) {
+		return false
+	}
+	herr, ok := err.(*HTTPError)
+	if !ok {
+		return true
+	}
+	for _, code := range p.StatusCodes {
+		if herr.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// repeatable reports whether req is idempotent and can be sent again
+func repeatable(req *http.Request) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+	default:
+		return false
+	}
+	return req.Body == nil || req.GetBody != nil
+}
+
+// backoff returns delay before the next attempt, attempt counts from 1
+func (p *RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if d, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			if d > p.MaxBackoff && p.MaxBackoff > 0 {
+				d = p.MaxBackoff
+			}
+			return d
+		}
+	}
+	d := p.MinBackoff << uint(attempt-1)
+	if d > p.MaxBackoff || d <= 0 {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryAfter parses Retry-After header given in seconds or as http date
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// sleep waits for d or until ctx is done
+func sleep(req *http.Request, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+// rewind returns a copy of req ready to be sent again
+func rewind(req *http.Request) (*http.Request, error) {
+	req = req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+	return req, nil
+}
+
+var errBodyRewound = errors.New("request body was rewound")
+
+// rewinder makes an io.Seeker request body re-readable. Bodies handed out
+// before the last rewind fail to read, so a transport still holding one
+// can't interfere with the next attempt.
+type rewinder struct {
+	sync.Mutex
+	r   io.ReadSeeker
+	off int64
+	cur *seekBody
+}
+
+func newRewinder(r io.ReadSeeker) (*rewinder, error) {
+	off, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	rw := &rewinder{r: r, off: off}
+	rw.cur = &seekBody{rw}
+	return rw, nil
+}
+
+func (rw *rewinder) rewind() (io.ReadCloser, error) {
+	rw.Lock()
+	defer rw.Unlock()
+	if _, err := rw.r.Seek(rw.off, io.SeekStart); err != nil {
+		return nil, err
+	}
+	rw.cur = &seekBody{rw}
+	return rw.cur, nil
+}
+
+// close closes the underlying reader once all attempts are done
+func (rw *rewinder) close() error {
+	rw.Lock()
+	defer rw.Unlock()
+	rw.cur = nil
+	if c, ok := rw.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+type seekBody struct {
+	rw *rewinder
+}
+
+func (b *seekBody) Read(p []byte) (int, error) {
+	b.rw.Lock()
+	defer b.rw.Unlock()
+	if b.rw.cur != b {
+		return 0, errBodyRewound
+	}
+	return b.rw.r.Read(p)
+}
+
+// Close is a no-op, the underlying reader is closed by rewinder
+func (b *seekBody) Close() error { return nil }
@@ -0,0 +1,152 @@
+package replica
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyServer fails the first fails requests with code, or drops the
+// connection when code is 0
+type flakyServer struct {
+	sync.Mutex
+	fails      int
+	code       int
+	retryAfter string
+	hits       int
+	body       string
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	s.hits++
+	fail := s.hits <= s.fails
+	s.Unlock()
+	buf, _ := ioutil.ReadAll(r.Body)
+	if !fail {
+		s.Lock()
+		s.body = string(buf)
+		s.Unlock()
+		return
+	}
+	if s.code == 0 {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+		return
+	}
+	s.Lock()
+	if s.retryAfter != "" {
+		w.Header().Set("Retry-After", s.retryAfter)
+	}
+	s.Unlock()
+	w.WriteHeader(s.code)
+}
+
+type onlySeeker struct{ io.ReadSeeker }
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	MinBackoff:  time.Millisecond,
+	MaxBackoff:  10 * time.Millisecond,
+	StatusCodes: DefaultRetryPolicy.StatusCodes,
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name  string
+		fails int
+		code  int
+		call  func(*Client) error
+		err   bool
+		hits  int
+		body  string
+	}{
+		{"reset", 2, 0, func(c *Client) error { _, err := c.GetInfo("f"); return err }, false, 3, ""},
+		{"unavailable", 2, 503, func(c *Client) error { return c.Exist("f") }, false, 3, ""},
+		{"exhausted", 3, 504, func(c *Client) error { return c.Remove("f") }, true, 3, ""},
+		{"not retryable code", 2, 500, func(c *Client) error { return c.Exist("f") }, true, 1, ""},
+		{"not idempotent", 2, 503, func(c *Client) error { return c.Update("f", nil, nil) }, true, 1, ""},
+		{"seekable body", 1, 502, func(c *Client) error {
+			r := onlySeeker{strings.NewReader("content")}
+			return c.CreateFile("f", &FileInfo{Size: 7}, r)
+		}, false, 2, "content"},
+		{"one shot body", 1, 502, func(c *Client) error {
+			r := io.MultiReader(strings.NewReader("content"))
+			return c.CreateFile("f", &FileInfo{Size: 7}, r)
+		}, true, 1, ""},
+	}
+	for _, tt := range tests {
+		srv := &flakyServer{fails: tt.fails, code: tt.code}
+		ts := httptest.NewServer(srv)
+		clt, _ := NewClient(ts.URL, AssignRetryPolicy(testRetryPolicy))
+		err := tt.call(clt)
+		ts.Close()
+		if (err != nil) != tt.err {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if srv.hits != tt.hits {
+			t.Errorf("%s: expected %d attempts, got %d", tt.name, tt.hits, srv.hits)
+		}
+		if srv.body != tt.body {
+			t.Errorf("%s: expected body %q, got %q", tt.name, tt.body, srv.body)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	srv := &flakyServer{fails: 1, code: 503, retryAfter: "1"}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	p := testRetryPolicy
+	p.MaxBackoff = 2 * time.Second
+	clt, _ := NewClient(ts.URL, AssignRetryPolicy(p))
+	start := time.Now()
+	if err := clt.Exist("f"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < time.Second {
+		t.Errorf("expected to wait Retry-After, retried after %v", d)
+	}
+
+	// delays over MaxBackoff are capped
+	srv.Lock()
+	srv.hits, srv.retryAfter = 0, "3600"
+	srv.Unlock()
+	clt, _ = NewClient(ts.URL, AssignRetryPolicy(testRetryPolicy))
+	start = time.Now()
+	if err := clt.Exist("f"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expected Retry-After capped at %v, retried after %v", testRetryPolicy.MaxBackoff, d)
+	}
+
+	for v, exp := range map[string]time.Duration{"3": 3 * time.Second, "": -1, "x": -1} {
+		d, ok := retryAfter(v)
+		if !ok {
+			d = -1
+		}
+		if d != exp {
+			t.Errorf("Retry-After %q expected %v, got %v", v, exp, d)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, max := range []time.Duration{0, 100, 200, 400, 800, 1000, 1000} {
+		if attempt == 0 {
+			continue
+		}
+		max *= time.Millisecond
+		d := p.backoff(attempt, nil)
+		if d < max/2 || d > max {
+			t.Errorf("attempt %d: expected backoff in [%v, %v], got %v", attempt, max/2, max, d)
+		}
+	}
+}
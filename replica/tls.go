@@ -0,0 +1,111 @@
+package replica
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrPinMismatch is returned when no certificate of the server matches
+// pins set by PinCertificates
+var ErrPinMismatch = errors.New("replica: server certificate does not match pins")
+
+// TLS options apply to the transport the client builds, not to one given
+// by HTTPClient or Transport. Their errors are returned by NewClient.
+
+// CABundle makes client verify server certificates with CA certificates
+// of PEM file instead of system ones, it may be given several times
+func CABundle(file string) func(*Client) {
+	return func(c *Client) {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			c.optionError(err)
+			return
+		}
+		cfg := c.tlsOptions()
+		if cfg.RootCAs == nil {
+			cfg.RootCAs = x509.NewCertPool()
+		}
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			c.optionError(fmt.Errorf("replica: no certificates in %s", file))
+		}
+	}
+}
+
+// ClientCertificate makes client present certificate of PEM files certFile
+// and keyFile to servers asking for one, for mutual TLS
+func ClientCertificate(certFile, keyFile string) func(*Client) {
+	return func(c *Client) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			c.optionError(err)
+			return
+		}
+		cfg := c.tlsOptions()
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+}
+
+// PinCertificates makes client accept only servers whose certificate
+// chain includes a certificate or public key with SHA-256 hash among
+// pins. Pins are hex encoded hashes of DER encoded certificate or of its
+// SubjectPublicKeyInfo, colons are allowed. Pins are checked also with
+// AllowUnsignedSSL, so a self-signed certificate can be pinned.
+func PinCertificates(pins ...string) func(*Client) {
+	return func(c *Client) {
+		set := make(map[[sha256.Size]byte]bool, len(pins))
+		for _, p := range pins {
+			buf, err := hex.DecodeString(strings.ReplaceAll(p, ":", ""))
+			if err != nil || len(buf) != sha256.Size {
+				c.optionError(fmt.Errorf("replica: invalid pin %q", p))
+				return
+			}
+			set[[sha256.Size]byte(buf)] = true
+		}
+		c.tlsOptions().VerifyConnection = func(cs tls.ConnectionState) error {
+			for _, cert := range cs.PeerCertificates {
+				if set[sha256.Sum256(cert.Raw)] || set[sha256.Sum256(cert.RawSubjectPublicKeyInfo)] {
+					return nil
+				}
+			}
+			return ErrPinMismatch
+		}
+	}
+}
+
+// MinTLSVersion sets the least TLS version accepted, like tls.VersionTLS12
+func MinTLSVersion(v uint16) func(*Client) {
+	return func(c *Client) {
+		c.tlsOptions().MinVersion = v
+	}
+}
+
+// tlsOptions returns TLS configuration set by options, creating it
+func (c *Client) tlsOptions() *tls.Config {
+	if c.tls == nil {
+		c.tls = &tls.Config{}
+	}
+	return c.tls
+}
+
+// tlsConfig returns TLS configuration of transport the client builds
+func (c *Client) tlsConfig() *tls.Config {
+	cfg := &tls.Config{}
+	if c.tls != nil {
+		cfg = c.tls.Clone()
+	}
+	cfg.InsecureSkipVerify = c.unsecureSSL
+	return cfg
+}
+
+// optionError records the first error of options
+func (c *Client) optionError(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
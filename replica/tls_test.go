@@ -0,0 +1,122 @@
+package replica
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCert writes self-signed certificate and its key as PEM files to dir
+func writeCert(t *testing.T, dir, name string) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+".key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder}), 0600)
+	cert, _ := x509.ParseCertificate(der)
+	return cert, certFile, keyFile
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	clientCert, certFile, keyFile := writeCert(t, dir, "client")
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 && strings.HasSuffix(r.URL.Path, "/mtls") {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(clientCert)
+	ts.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: pool, MaxVersion: tls.VersionTLS12}
+	ts.StartTLS()
+	defer ts.Close()
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0600)
+	certPin := sha256.Sum256(ts.Certificate().Raw)
+	keyPin := sha256.Sum256(ts.Certificate().RawSubjectPublicKeyInfo)
+	var colonPin []string
+	for _, b := range keyPin {
+		colonPin = append(colonPin, hex.EncodeToString([]byte{b}))
+	}
+
+	tests := []struct {
+		name string
+		path string
+		opts []func(*Client)
+		err  error // nil for any error
+		ok   bool
+	}{
+		{"system roots", "f", nil, nil, false},
+		{"CA bundle", "f", []func(*Client){CABundle(caFile)}, nil, true},
+		{"unsigned", "f", []func(*Client){AllowUnsignedSSL}, nil, true},
+		{"certificate pin", "f", []func(*Client){CABundle(caFile), PinCertificates(hex.EncodeToString(certPin[:]))}, nil, true},
+		{"key pin", "f", []func(*Client){AllowUnsignedSSL, PinCertificates(strings.Repeat("00", 32), strings.Join(colonPin, ":"))}, nil, true},
+		{"wrong pin", "f", []func(*Client){AllowUnsignedSSL, PinCertificates(strings.Repeat("00", 32))}, ErrPinMismatch, false},
+		{"min version", "f", []func(*Client){CABundle(caFile), MinTLSVersion(tls.VersionTLS13)}, nil, false},
+		{"no client certificate", "mtls", []func(*Client){CABundle(caFile)}, ErrForbidden, false},
+		{"client certificate", "mtls", []func(*Client){CABundle(caFile), ClientCertificate(certFile, keyFile)}, nil, true},
+	}
+	for _, tt := range tests {
+		clt, err := NewClient(ts.URL, tt.opts...)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		err = clt.Exist(tt.path)
+		if (err == nil) != tt.ok || tt.err != nil && !errors.Is(err, tt.err) {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+	}
+
+	// TLS options keep settings of the default transport
+	clt, _ := NewClient(ts.URL, CABundle(caFile))
+	tr, ok := clt.client().Transport.(*http.Transport)
+	if !ok || tr.Proxy == nil || !tr.ForceAttemptHTTP2 || tr.TLSClientConfig.RootCAs == nil {
+		t.Errorf("unexpected transport %#v", clt.client().Transport)
+	}
+
+	for _, opt := range []func(*Client){
+		CABundle(filepath.Join(dir, "none.pem")),
+		CABundle(keyFile),
+		ClientCertificate(certFile, caFile),
+		PinCertificates("abc"),
+	} {
+		if _, err := NewClient(ts.URL, opt); err == nil {
+			t.Error("expected option error, got <nil>")
+		}
+	}
+}
@@ -1,11 +1,16 @@
 package replica
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"net/http"
 	"time"
 )
 
+// tokenRefreshMargin is how long before expiration a token is renewed
+const tokenRefreshMargin = 30 * time.Second
+
 // Token struct for token information
 type Token struct {
 	Token   string `json:"auth_token"`
@@ -19,39 +24,141 @@ func (t *Token) Valid() bool {
 	return time.Now().Unix() < t.Expires
 }
 
+// CredentialsFunc returns user name and password used to obtain a token
+type CredentialsFunc func(ctx context.Context) (user, passwd string, err error)
+
+// AssignCredentials set user name and password the client uses to obtain
+// and refresh its token
+func AssignCredentials(user, passwd string) func(*Client) {
+	return AssignCredentialsFunc(func(context.Context) (string, string, error) {
+		return user, passwd, nil
+	})
+}
+
+// AssignCredentialsFunc set a callback the client asks for credentials
+// every time it needs a new token
+func AssignCredentialsFunc(fn CredentialsFunc) func(*Client) {
+	return func(c *Client) {
+		c.creds = fn
+	}
+}
+
 // GetToken returns a token or error if auth failes
 func (c *Client) GetToken(user, passwd string) (*Token, error) {
+	return c.GetTokenContext(context.Background(), user, passwd)
+}
+
+// GetTokenContext is like GetToken but carries ctx
+func (c *Client) GetTokenContext(ctx context.Context, user, passwd string) (*Token, error) {
 	headers := map[string]string{"X-Auth-User": user, "X-Auth-Password": passwd}
-	return c.getToken(headers)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.getToken(ctx, headers)
 }
 
 // Token returns clients token
 func (c *Client) Token() (*Token, error) {
+	return c.TokenContext(context.Background())
+}
+
+// TokenContext is like Token but carries ctx
+func (c *Client) TokenContext(ctx context.Context) (*Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.token == nil || c.token.String() == "" {
 		return nil, errors.New("token not set")
 	}
 	headers := map[string]string{"X-Auth-Token": c.token.String()}
-	return c.getToken(headers)
+	return c.getToken(ctx, headers)
 }
 
-func (c *Client) getToken(headers map[string]string) (*Token, error) {
+// getToken is called with c.mu held
+func (c *Client) getToken(ctx context.Context, headers map[string]string) (*Token, error) {
 	if c.token != nil && c.token.Valid() {
 		return c.token, nil
 	}
-	req, err := c.newRequest("GET", "token", nil)
+	return c.fetchToken(ctx, headers)
+}
+
+// fetchToken is called with c.mu held
+func (c *Client) fetchToken(ctx context.Context, headers map[string]string) (*Token, error) {
+	req, err := c.newRequest(ctx, "GET", "token", nil)
 	if err != nil {
 		return nil, err
 	}
 	for k, v := range headers {
 		req.Header.Add(k, v)
 	}
-	resp, err := c.do(req)
+	resp, err := c.send(req)
 	if err != nil {
 		return nil, err
 	}
-	err = json.NewDecoder(resp.Body).Decode(c.token)
+	defer resp.Body.Close()
+	tk := new(Token)
+	err = json.NewDecoder(resp.Body).Decode(tk)
 	if err != nil {
 		return nil, err
 	}
+	if c.token == nil {
+		c.token = tk
+	} else {
+		*c.token = *tk
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		c.skew = t.Sub(time.Now())
+	}
 	return c.token, nil
 }
+
+// authToken returns the token to send with a request, obtaining a new one
+// from credentials when the current token is missing or about to expire
+func (c *Client) authToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.creds == nil || c.tokenFresh() {
+		if c.token == nil {
+			return "", nil
+		}
+		return c.token.String(), nil
+	}
+	return c.renewToken(ctx)
+}
+
+// refreshToken obtains a new token after stale was rejected by the server,
+// unless another request already replaced it
+func (c *Client) refreshToken(ctx context.Context, stale string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != nil && c.token.String() != stale {
+		return c.token.String(), nil
+	}
+	return c.renewToken(ctx)
+}
+
+// renewToken is called with c.mu held
+func (c *Client) renewToken(ctx context.Context) (string, error) {
+	user, passwd, err := c.creds(ctx)
+	if err != nil {
+		return "", err
+	}
+	headers := map[string]string{"X-Auth-User": user, "X-Auth-Password": passwd}
+	tk, err := c.fetchToken(ctx, headers)
+	if err != nil {
+		return "", err
+	}
+	return tk.String(), nil
+}
+
+// tokenFresh reports whether the token is set and, measured by the server
+// clock, does not expire within tokenRefreshMargin. Tokens with unknown
+// expiration are considered fresh until the server rejects them.
+func (c *Client) tokenFresh() bool {
+	if c.token == nil || c.token.String() == "" {
+		return false
+	}
+	if c.token.Expires == 0 {
+		return true
+	}
+	now := time.Now().Add(c.skew + tokenRefreshMargin)
+	return now.Unix() < c.token.Expires
+}
@@ -0,0 +1,111 @@
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tokenServer issues tokens valid for ttl and rejects revoked ones
+type tokenServer struct {
+	sync.Mutex
+	ttl     time.Duration
+	offset  time.Duration // server clock minus real clock
+	issued  int
+	current string
+}
+
+func (s *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now().Add(s.offset)
+	w.Header().Set("Date", now.UTC().Format(http.TimeFormat))
+	if r.URL.Path == "/token" {
+		if r.Header.Get("X-Auth-User") != "test" || r.Header.Get("X-Auth-Password") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		s.issued++
+		s.current = fmt.Sprint("token-", s.issued)
+		json.NewEncoder(w).Encode(&Token{Token: s.current, Expires: now.Add(s.ttl).Unix()})
+		return
+	}
+	if r.Header.Get("X-Auth-Token") != s.current {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+}
+
+func (s *tokenServer) revoke() {
+	s.Lock()
+	s.current = "revoked"
+	s.Unlock()
+}
+
+func (s *tokenServer) count() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.issued
+}
+
+func TestCredentials(t *testing.T) {
+	srv := &tokenServer{ttl: time.Hour}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	clt, _ := NewClient(ts.URL, AssignCredentials("test", "secret"))
+	for i := 0; i < 3; i++ {
+		if err := clt.Exist("file"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if srv.count() != 1 {
+		t.Errorf("expected 1 token request, got %d", srv.count())
+	}
+
+	// rejected token is renewed and the request retried
+	srv.revoke()
+	if err := clt.Exist("file"); err != nil {
+		t.Fatal(err)
+	}
+	if srv.count() != 2 {
+		t.Errorf("expected 2 token requests, got %d", srv.count())
+	}
+
+	// wrong credentials are reported
+	clt, _ = NewClient(ts.URL, AssignCredentials("test", "wrong"))
+	if err := clt.Exist("file"); err == nil {
+		t.Error("expected unauthorized error, got <nil>")
+	}
+
+	cerr := errors.New("no credentials")
+	clt, _ = NewClient(ts.URL, AssignCredentialsFunc(func(context.Context) (string, string, error) {
+		return "", "", cerr
+	}))
+	if err := clt.Exist("file"); err != cerr {
+		t.Errorf("expected %v, got %v", cerr, err)
+	}
+}
+
+func TestCredentialsClockSkew(t *testing.T) {
+	// server clock is an hour behind, by local clock tokens are expired
+	srv := &tokenServer{ttl: 5 * time.Minute, offset: -time.Hour}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	clt, _ := NewClient(ts.URL, AssignCredentials("test", "secret"))
+	for i := 0; i < 2; i++ {
+		if err := clt.Exist("file"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if srv.count() != 1 {
+		t.Errorf("expected 1 token request, got %d", srv.count())
+	}
+}
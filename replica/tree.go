@@ -0,0 +1,265 @@
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultConcurrency = 4
+	// MetaSidecarSuffix is appended to name of downloaded file to name the
+	// file its metadata is written to
+	MetaSidecarSuffix = ".meta.json"
+)
+
+// TransferResult describes transfer of a single file of a tree
+type TransferResult struct {
+	Local  string
+	Remote string
+	Size   int64
+	Err    error
+}
+
+// UploadOptions configures UploadTree and UploadFile
+type UploadOptions struct {
+	// Concurrency is the number of files, or chunks of a single file,
+	// uploaded at once, 4 by default
+	Concurrency int
+	// ReplicaCount and MetaData are applied to every file and directory
+	ReplicaCount int
+	MetaData     map[string]string
+	// FileMeta, when set, returns replica count and metadata of the file at
+	// slash separated path rel, overriding ReplicaCount and MetaData
+	FileMeta func(rel string) (int, map[string]string)
+	// ChunkSize, when positive, makes files bigger than ChunkSize upload in
+	// chunks of that size, see UploadFile
+	ChunkSize int64
+	// Retries is the number of times a failed chunk upload is repeated
+	Retries int
+	// StateDir is the directory state of chunked uploads is kept in,
+	// os.TempDir() by default
+	StateDir string
+	// Progress, when set, is called with progress of the whole transfer
+	Progress ProgressFunc
+	// Preconditions every uploaded file must meet, like CreateOnly, they
+	// apply to the manifest of a file uploaded in chunks
+	Preconditions Preconditions
+}
+
+// UploadTree uploads content of localDir into remoteDir, creating missing
+// directories. It returns a result for every regular file and an error
+// joining all failures.
+func (c *Client) UploadTree(localDir, remoteDir string, opts *UploadOptions) ([]TransferResult, error) {
+	return c.UploadTreeContext(context.Background(), localDir, remoteDir, opts)
+}
+
+// UploadTreeContext is like UploadTree but carries ctx
+func (c *Client) UploadTreeContext(ctx context.Context, localDir, remoteDir string, opts *UploadOptions) ([]TransferResult, error) {
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+	var results []TransferResult
+	err := filepath.WalkDir(localDir, func(name string, d fs.DirEntry, err error) error {
+		rel, rerr := filepath.Rel(localDir, name)
+		if rerr != nil {
+			return rerr
+		}
+		remote := path.Join(remoteDir, filepath.ToSlash(rel))
+		if err != nil {
+			results = append(results, TransferResult{Local: name, Remote: remote, Err: err})
+			return nil
+		}
+		if d.IsDir() {
+			if remote == "" || remote == "." {
+				return nil
+			}
+			err = c.CreateDirContext(ctx, remote, opts.ReplicaCount, opts.MetaData)
+			if errors.Is(err, ErrConflict) {
+				err = nil
+			}
+			if err != nil {
+				results = append(results, TransferResult{Local: name, Remote: remote, Err: err})
+				return filepath.SkipDir
+			}
+			return ctx.Err()
+		}
+		if d.Type().IsRegular() {
+			r := TransferResult{Local: name, Remote: remote}
+			if info, err := d.Info(); err == nil {
+				r.Size = info.Size()
+			}
+			results = append(results, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return results, err
+	}
+
+	if opts.Progress != nil {
+		ctx = context.WithValue(ctx, progressKey{}, newTracker(opts.Progress, totalSize(results)))
+	}
+	transfer(ctx, results, opts.Concurrency, func(r *TransferResult) error {
+		fopts := *opts
+		fopts.Concurrency, fopts.Progress = 1, nil
+		if opts.FileMeta != nil {
+			rel, _ := filepath.Rel(localDir, r.Local)
+			fopts.ReplicaCount, fopts.MetaData = opts.FileMeta(filepath.ToSlash(rel))
+		}
+		fi, err := c.UploadFileContext(ctx, r.Local, r.Remote, &fopts)
+		if err != nil {
+			return err
+		}
+		r.Size = fi.Size
+		return nil
+	})
+	return results, joinResults(results)
+}
+
+// DownloadOptions configures DownloadTree and DownloadFile
+type DownloadOptions struct {
+	// Concurrency is the number of files downloaded at once, 4 by default
+	Concurrency int
+	// MetaSidecar enables writing file metadata next to every downloaded
+	// file into a file with MetaSidecarSuffix
+	MetaSidecar bool
+	// Retries is the number of times an interrupted download, or a failed
+	// range of parallel download, is resumed before giving up
+	Retries int
+	// Connections, when greater than one, makes files bigger than PartSize
+	// download as ranges of PartSize fetched that many at once
+	Connections int
+	// PartSize is size of ranges of parallel download, 8 MiB by default
+	PartSize int64
+	// Progress, when set, is called with progress of the whole transfer
+	Progress ProgressFunc
+	// Preconditions every downloaded file must meet
+	Preconditions Preconditions
+}
+
+// sidecar is content of metadata sidecar file
+type sidecar struct {
+	ContentType  string            `json:"content_type,omitempty"`
+	ReplicaCount int               `json:"replica_count,omitempty"`
+	MetaData     map[string]string `json:"meta_data,omitempty"`
+}
+
+// DownloadTree downloads content of remoteDir into localDir recreating its
+// directory structure and modification times. It returns a result for
+// every file and an error joining all failures.
+func (c *Client) DownloadTree(remoteDir, localDir string, opts *DownloadOptions) ([]TransferResult, error) {
+	return c.DownloadTreeContext(context.Background(), remoteDir, localDir, opts)
+}
+
+// DownloadTreeContext is like DownloadTree but carries ctx
+func (c *Client) DownloadTreeContext(ctx context.Context, remoteDir, localDir string, opts *DownloadOptions) ([]TransferResult, error) {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+	var results []TransferResult
+	err := c.WalkContext(ctx, remoteDir, func(p string, fi *FileInfo, err error) error {
+		local := filepath.Join(localDir, filepath.FromSlash(strings.TrimPrefix(p, remoteDir)))
+		switch {
+		case err != nil && p == remoteDir:
+			return err
+		case err != nil:
+			results = append(results, TransferResult{Local: local, Remote: p, Err: err})
+			return nil
+		case !fi.IsDir && p == remoteDir:
+			return fmt.Errorf("%s: not a directory", p)
+		case fi.IsDir:
+			return os.MkdirAll(local, 0755)
+		}
+		results = append(results, TransferResult{Local: local, Remote: p, Size: fi.Size})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fopts := *opts
+	if opts.Progress != nil {
+		ctx = context.WithValue(ctx, progressKey{}, newTracker(opts.Progress, totalSize(results)))
+		fopts.Progress = nil
+	}
+	transfer(ctx, results, opts.Concurrency, func(r *TransferResult) error {
+		fi, err := c.DownloadFileContext(ctx, r.Remote, r.Local, &fopts)
+		if err != nil {
+			return err
+		}
+		r.Size = fi.Size
+		return nil
+	})
+	return results, joinResults(results)
+}
+
+// writeSidecar writes metadata of fi next to local file
+func writeSidecar(local string, fi *FileInfo) error {
+	buf, err := json.MarshalIndent(&sidecar{
+		ContentType:  fi.ContentType(),
+		ReplicaCount: fi.ReplicaCount(),
+		MetaData:     fi.MetaData(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(local+MetaSidecarSuffix, buf, 0644)
+}
+
+// transfer runs fn for every result without error, with at most
+// concurrency running at once, and records returned errors
+func transfer(ctx context.Context, results []TransferResult, concurrency int, fn func(*TransferResult) error) {
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	jobs := make(chan *TransferResult)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range jobs {
+				if err := ctx.Err(); err != nil {
+					r.Err = err
+					continue
+				}
+				r.Err = fn(r)
+			}
+		}()
+	}
+	for i := range results {
+		if results[i].Err == nil {
+			jobs <- &results[i]
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// totalSize sums sizes of results
+func totalSize(results []TransferResult) int64 {
+	var n int64
+	for _, r := range results {
+		n += r.Size
+	}
+	return n
+}
+
+// joinResults joins errors of failed transfers
+func joinResults(results []TransferResult) error {
+	var errs []error
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.Remote, r.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
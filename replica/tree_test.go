@@ -0,0 +1,245 @@
+package replica
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTree creates files of tree, mapping slash separated names to
+// content, under dir
+func writeTree(t *testing.T, dir string, tree map[string]string) {
+	for name, data := range tree {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+var testTree = map[string]string{
+	"a.txt":         "alpha",
+	"b/c.txt":       "charlie",
+	"b/d/e.txt":     "echo",
+	"b/d/f/g.txt":   "golf",
+	"h/i.txt":       "india",
+	"h/j/k/l/m.txt": "mike",
+}
+
+func TestUploadTree(t *testing.T) {
+	clt, _ := newTestClient(t)
+	local := t.TempDir()
+	writeTree(t, local, testTree)
+	os.Mkdir(filepath.Join(local, "empty"), 0755)
+
+	opts := &UploadOptions{
+		Concurrency:  3,
+		ReplicaCount: 2,
+		MetaData:     map[string]string{"Tree": "test"},
+		FileMeta: func(rel string) (int, map[string]string) {
+			if rel == "a.txt" {
+				return 1, map[string]string{"Name": "alpha"}
+			}
+			return 2, map[string]string{"Tree": "test"}
+		},
+	}
+	results, err := clt.UploadTree(local, "public/up", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(testTree) {
+		t.Errorf("expected %d results, got %d", len(testTree), len(results))
+	}
+	for _, r := range results {
+		if r.Size != int64(len(testTree[strings.TrimPrefix(r.Remote, "public/up/")])) {
+			t.Errorf("%s: unexpected size %d", r.Remote, r.Size)
+		}
+	}
+	for name, data := range testTree {
+		rc, _, err := clt.Get("public/up/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		if string(buf) != data {
+			t.Errorf("%s: expected %s, got %s", name, data, buf)
+		}
+	}
+	fi, err := clt.GetInfo("public/up/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.ReplicaCount() != 1 || fi.MetaData()["Name"] != "alpha" {
+		t.Errorf("unexpected file info %+v", fi)
+	}
+	fi, err = clt.GetInfo("public/up/b/c.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.ReplicaCount() != 2 || fi.MetaData()["Tree"] != "test" {
+		t.Errorf("unexpected file info %+v", fi)
+	}
+	if err := clt.Exist("public/up/empty"); err != nil {
+		t.Error(err)
+	}
+
+	// upload again over existing directories
+	if _, err := clt.UploadTree(local, "public/up", nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUploadTreeFail(t *testing.T) {
+	clt, _ := newTestClient(t)
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{"ok.txt": "ok", "empty.txt": "", "dir/x.txt": "x"})
+	if err := clt.CreateDir("public/up", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	// a file in place of a directory
+	fi := &FileInfo{Size: 1}
+	if err := clt.CreateFile("public/up/dir", fi, strings.NewReader("d")); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := clt.UploadTree(local, "public/up", nil)
+	if err == nil {
+		t.Fatal("expected error, got <nil>")
+	}
+	failed := map[string]bool{}
+	for _, r := range results {
+		if r.Err != nil {
+			failed[r.Remote] = true
+		}
+	}
+	if len(results) != 3 || !failed["public/up/empty.txt"] || !failed["public/up/dir/x.txt"] ||
+		failed["public/up/ok.txt"] {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if !strings.Contains(err.Error(), "public/up/empty.txt") {
+		t.Errorf("expected error to name failed file, got %v", err)
+	}
+}
+
+func TestDownloadTree(t *testing.T) {
+	clt, _ := newTestClient(t)
+	src := t.TempDir()
+	writeTree(t, src, testTree)
+	opts := &UploadOptions{MetaData: map[string]string{"Tree": "test"}}
+	if _, err := clt.UploadTree(src, "public/tree", opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := clt.CreateDir("public/tree/empty", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	results, err := clt.DownloadTree("public/tree", dst, &DownloadOptions{Concurrency: 2, MetaSidecar: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(testTree) {
+		t.Errorf("expected %d results, got %d", len(testTree), len(results))
+	}
+	for name, data := range testTree {
+		p := filepath.Join(dst, filepath.FromSlash(name))
+		buf, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != data {
+			t.Errorf("%s: expected %s, got %s", name, data, buf)
+		}
+		fi, err := clt.GetInfo("public/tree/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		st, _ := os.Stat(p)
+		if !st.ModTime().Truncate(time.Second).Equal(fi.ModTime) {
+			t.Errorf("%s: expected mod time %v, got %v", name, fi.ModTime, st.ModTime())
+		}
+		buf, err = ioutil.ReadFile(p + MetaSidecarSuffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc := &sidecar{}
+		if err = json.Unmarshal(buf, sc); err != nil {
+			t.Fatal(err)
+		}
+		if sc.MetaData["Tree"] != "test" {
+			t.Errorf("%s: unexpected sidecar %s", name, buf)
+		}
+	}
+	if st, err := os.Stat(filepath.Join(dst, "empty")); err != nil || !st.IsDir() {
+		t.Errorf("expected empty directory, got %v", err)
+	}
+
+	if _, err := clt.DownloadTree("public/tree/a.txt", dst, nil); err == nil {
+		t.Error("expected not a directory error, got <nil>")
+	}
+	if _, err := clt.DownloadTree("public/none", dst, nil); err == nil {
+		t.Error("expected not found error, got <nil>")
+	}
+}
+
+func TestTreeChunked(t *testing.T) {
+	clt, _ := newTestClient(t)
+	src := t.TempDir()
+	tree := map[string]string{"small.txt": "small", "d/big": string(randomData(2500))}
+	writeTree(t, src, tree)
+	opts := &UploadOptions{ChunkSize: 1000, StateDir: t.TempDir()}
+	if _, err := clt.UploadTree(src, "public/chunked", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	var walked []string
+	err := clt.Walk("public/chunked", func(p string, fi *FileInfo, err error) error {
+		walked = append(walked, p)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"public/chunked", "public/chunked/d", "public/chunked/d/big", "public/chunked/small.txt"}; !reflect.DeepEqual(walked, exp) {
+		t.Errorf("expected walk %q, got %q", exp, walked)
+	}
+	entries, err := clt.FS("public/chunked").ReadDir("d")
+	if err != nil || len(entries) != 1 || entries[0].Name() != "big" {
+		t.Errorf("expected only big in d, got %v %v", entries, err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	results, err := clt.DownloadTree("public/chunked", dst, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(tree) {
+		t.Errorf("expected %d results, got %d", len(tree), len(results))
+	}
+	for name, data := range tree {
+		buf, err := ioutil.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != data {
+			t.Errorf("%s: downloaded content differs", name)
+		}
+	}
+
+	if err := clt.Remove("public/chunked/d/big"); err != nil {
+		t.Fatal(err)
+	}
+	if err := clt.Exist("public/chunked/d/big" + ChunksSuffix); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected chunks removed, got %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package replica
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// uploadState records chunks of a local file already uploaded
+type uploadState struct {
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mod_time"`
+	ChunkSize int64     `json:"chunk_size"`
+	Done      []bool    `json:"done"`
+}
+
+// UploadFile uploads local file to remote path. Files bigger than positive
+// opts.ChunkSize are uploaded as chunks into directory remote+ChunksSuffix,
+// repeating each failed chunk up to opts.Retries times. Uploaded chunks are
+// recorded in a state file in opts.StateDir, so calling UploadFile again
+// after a failure uploads only the missing ones. As the server can not join
+// chunks, remote gets a manifest listing them which Get and DownloadFile
+// reassemble, removing such file takes removing both remote and its chunk
+// directory.
+func (c *Client) UploadFile(local, remote string, opts *UploadOptions) (*FileInfo, error) {
+	return c.UploadFileContext(context.Background(), local, remote, opts)
+}
+
+// UploadFileContext is like UploadFile but carries ctx
+func (c *Client) UploadFileContext(ctx context.Context, local, remote string, opts *UploadOptions) (*FileInfo, error) {
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+	fi, rdc, err := OpenFile(local, opts.ReplicaCount, opts.MetaData)
+	if err != nil {
+		return nil, err
+	}
+	defer rdc.Close()
+	if fi.IsDir {
+		return nil, fmt.Errorf("%s: is a directory", local)
+	}
+	if opts.Progress != nil {
+		ctx = context.WithValue(ctx, progressKey{}, newTracker(opts.Progress, fi.Size))
+	}
+	if opts.ChunkSize <= 0 || fi.Size <= opts.ChunkSize {
+		err = c.CreateFileIf(ctx, remote, fi, rdc, opts.Preconditions)
+	} else {
+		err = c.uploadChunks(ctx, local, remote, fi, rdc.(io.ReaderAt), opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fi, nil
+}
+
+// uploadChunks uploads chunks of local file missing from its upload state
+// and the manifest listing them
+func (c *Client) uploadChunks(ctx context.Context, local, remote string, fi *FileInfo, r io.ReaderAt, opts *UploadOptions) error {
+	statePath, err := c.uploadStatePath(local, remote, opts.StateDir)
+	if err != nil {
+		return err
+	}
+	mctx := withoutProgress(ctx)
+	dir := remote + ChunksSuffix
+	st := loadUploadState(statePath, fi, opts.ChunkSize)
+	if st != nil && c.ExistContext(ctx, dir) != nil {
+		st = nil
+	}
+	if st == nil {
+		// start over, dropping chunks of any earlier upload
+		err = c.RemoveAllContext(ctx, dir)
+		if errors.Is(err, ErrNotFound) {
+			err = nil
+		}
+		if err == nil {
+			err = c.CreateDirContext(ctx, dir, fi.replicaCount, nil)
+		}
+		if err != nil {
+			return err
+		}
+		n := (fi.Size + opts.ChunkSize - 1) / opts.ChunkSize
+		st = &uploadState{Size: fi.Size, ModTime: fi.ModTime.UTC(), ChunkSize: opts.ChunkSize, Done: make([]bool, n)}
+		if err = st.save(statePath); err != nil {
+			return err
+		}
+	}
+
+	m := &manifest{Size: fi.Size, ChunkSize: opts.ChunkSize, ContentType: fi.contentType}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	sem := make(chan struct{}, concurrency)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex // guards st and errs
+		errs []error
+	)
+	for i, done := range st.Done {
+		name := fmt.Sprintf("%s/%08d", dir, i)
+		m.Chunks = append(m.Chunks, name)
+		if done {
+			if t := progressFrom(ctx); t != nil && t.fixed {
+				t.add(m.chunkLen(i), false)
+			}
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int, name string) {
+			defer func() { <-sem; wg.Done() }()
+			err := c.uploadChunk(ctx, name, io.NewSectionReader(r, int64(i)*m.ChunkSize, m.chunkLen(i)), fi, opts.Retries)
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				st.Done[i] = true
+				err = st.save(statePath)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}(i, name)
+	}
+	wg.Wait()
+	if err = ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	if err = errors.Join(errs...); err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	mfi := &FileInfo{
+		Size:         int64(len(buf)),
+		contentType:  ManifestContentType,
+		replicaCount: fi.replicaCount,
+		metaData:     withLogicalSize(fi.metaData, fi.Size),
+	}
+	if err = c.CreateFileIf(mctx, remote, mfi, bytes.NewReader(buf), opts.Preconditions); err != nil {
+		return err
+	}
+	os.Remove(statePath)
+	return nil
+}
+
+// uploadChunk uploads chunk r, repeating failed attempt up to retries times
+func (c *Client) uploadChunk(ctx context.Context, name string, r *io.SectionReader, fi *FileInfo, retries int) error {
+	cfi := &FileInfo{Size: r.Size(), contentType: "application/octet-stream", replicaCount: fi.replicaCount}
+	for attempt := 0; ; attempt++ {
+		err := c.CreateFileContext(ctx, name, cfi, r)
+		if !Retryable(err) || attempt >= retries || ctx.Err() != nil {
+			return err
+		}
+		if _, err = r.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+}
+
+// uploadStatePath returns path of state file of upload of local to remote
+func (c *Client) uploadStatePath(local, remote, dir string) (string, error) {
+	abs, err := filepath.Abs(local)
+	if err != nil {
+		return "", err
+	}
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	sum := sha256.Sum256([]byte(abs + "\n" + c.addr + "\n" + remote))
+	return filepath.Join(dir, "replica-upload-"+hex.EncodeToString(sum[:16])+".json"), nil
+}
+
+// loadUploadState reads upload state at p, it returns nil unless the state
+// is of the same version of local file split into chunks of the same size
+func loadUploadState(p string, fi *FileInfo, chunkSize int64) *uploadState {
+	buf, err := os.ReadFile(p)
+	if err != nil {
+		return nil
+	}
+	st := &uploadState{}
+	if json.Unmarshal(buf, st) != nil || st.Size != fi.Size || !st.ModTime.Equal(fi.ModTime) ||
+		st.ChunkSize != chunkSize || int64(len(st.Done)) != (fi.Size+chunkSize-1)/chunkSize {
+		return nil
+	}
+	return st
+}
+
+func (st *uploadState) save(p string) error {
+	buf, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, buf, 0644)
+}
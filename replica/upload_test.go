@@ -0,0 +1,154 @@
+package replica
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// putServer fails the first fails uploads of paths ending with fail and
+// records paths of uploads
+type putServer struct {
+	h     http.Handler
+	fail  string
+	mu    sync.Mutex
+	fails int
+	puts  []string
+}
+
+func (s *putServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		s.h.ServeHTTP(w, r)
+		return
+	}
+	s.mu.Lock()
+	s.puts = append(s.puts, r.URL.Path)
+	fail := s.fail != "" && strings.HasSuffix(r.URL.Path, s.fail) && s.fails > 0
+	if fail {
+		s.fails--
+	}
+	s.mu.Unlock()
+	if fail {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s.h.ServeHTTP(w, r)
+}
+
+func TestUploadFileChunked(t *testing.T) {
+	_, srv := newTestClient(t)
+	ps := &putServer{h: srv, fail: "/00000001", fails: 1}
+	ts := httptest.NewServer(ps)
+	defer ts.Close()
+	clt, err := NewClient(ts.URL, AssignCredentials("test", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := randomData(2500)
+	local := filepath.Join(t.TempDir(), "big")
+	if err := os.WriteFile(local, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := &UploadOptions{ChunkSize: 1000, Concurrency: 1, StateDir: t.TempDir()}
+
+	if _, err := clt.UploadFile(local, "public/big", opts); err == nil {
+		t.Fatal("expected error, got <nil>")
+	}
+	ps.puts = nil
+	fi, err := clt.UploadFile(local, "public/big", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size != 2500 {
+		t.Errorf("expected size 2500, got %d", fi.Size)
+	}
+	// rerun uploads only the failed chunk and the manifest
+	if len(ps.puts) != 2 || !strings.HasSuffix(ps.puts[0], "/big.chunks/00000001") ||
+		!strings.HasSuffix(ps.puts[1], "/big") {
+		t.Errorf("unexpected uploads %q", ps.puts)
+	}
+	if states, _ := os.ReadDir(opts.StateDir); len(states) != 0 {
+		t.Errorf("expected state removed, got %d files", len(states))
+	}
+
+	rc, _, err := clt.Get("public/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data) {
+		t.Error("reassembled content differs")
+	}
+
+	dst := filepath.Join(t.TempDir(), "big")
+	if fi, err = clt.DownloadFile("public/big", dst, nil); err != nil {
+		t.Fatal(err)
+	}
+	buf, _ = os.ReadFile(dst)
+	if fi.Size != 2500 || !bytes.Equal(buf, data) {
+		t.Errorf("downloaded content differs, size %d", fi.Size)
+	}
+	if _, err := clt.Open("public/big"); err == nil {
+		t.Error("expected error opening chunked file, got <nil>")
+	}
+}
+
+func TestUploadFileChunkedReplaced(t *testing.T) {
+	clt, _ := newTestClient(t)
+	local := filepath.Join(t.TempDir(), "big")
+	if err := os.WriteFile(local, randomData(2500), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clt.UploadFile(local, "public/big", &UploadOptions{ChunkSize: 1000, StateDir: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	// plain upload leaves chunks of the chunked one behind
+	if _, err := clt.UploadFile(local, "public/big", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := clt.Remove("public/big"); err != nil {
+		t.Fatal(err)
+	}
+	if err := clt.Exist("public/big" + ChunksSuffix); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected chunks removed, got %v", err)
+	}
+	if err := clt.Remove("public/big"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
+
+func TestUploadFileRetries(t *testing.T) {
+	_, srv := newTestClient(t)
+	ps := &putServer{h: srv, fail: "/00000000", fails: 2}
+	ts := httptest.NewServer(ps)
+	defer ts.Close()
+	clt, _ := NewClient(ts.URL, AssignCredentials("test", "secret"))
+	data := randomData(1500)
+	local := filepath.Join(t.TempDir(), "big")
+	os.WriteFile(local, data, 0644)
+
+	opts := &UploadOptions{ChunkSize: 1000, Retries: 2, StateDir: t.TempDir()}
+	if _, err := clt.UploadFile(local, "public/big", opts); err != nil {
+		t.Fatal(err)
+	}
+	rc, _, err := clt.Get("public/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if buf, _ := io.ReadAll(rc); !bytes.Equal(buf, data) {
+		t.Error("reassembled content differs")
+	}
+}
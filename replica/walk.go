@@ -0,0 +1,166 @@
+package replica
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// WalkFunc is the type of function called by Walk for every file or
+// directory, it follows semantics of filepath.WalkDirFunc
+type WalkFunc func(path string, fi *FileInfo, err error) error
+
+// ParallelListing set the number of directories Walk lists at once, when
+// greater than one, subdirectories are listed ahead of being visited
+func ParallelListing(n int) func(*Client) {
+	return func(c *Client) {
+		c.listing = n
+	}
+}
+
+// Walk walks remote file tree rooted at root calling fn for each file or
+// directory, including root. Files are visited in order of Files sort,
+// directories first, and fn may return filepath.SkipDir or fs.SkipAll
+// like for filepath.WalkDir.
+func (c *Client) Walk(root string, fn WalkFunc) error {
+	return c.WalkContext(context.Background(), root, fn)
+}
+
+// WalkContext is like Walk but carries ctx
+func (c *Client) WalkContext(ctx context.Context, root string, fn WalkFunc) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := &walker{c: c, ctx: ctx, fn: fn}
+	if c.listing > 1 {
+		w.sem = make(chan struct{}, c.listing)
+	}
+	fi, err := c.GetInfoContext(ctx, root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = w.walk(root, fi, nil)
+	}
+	if err == filepath.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// WalkDir is like Walk but passes fs.DirEntry to fn
+func (c *Client) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return c.WalkDirContext(context.Background(), root, fn)
+}
+
+// WalkDirContext is like WalkDir but carries ctx
+func (c *Client) WalkDirContext(ctx context.Context, root string, fn fs.WalkDirFunc) error {
+	return c.WalkContext(ctx, root, func(p string, fi *FileInfo, err error) error {
+		if fi == nil {
+			return fn(p, nil, err)
+		}
+		return fn(p, fi.DirEntry(), err)
+	})
+}
+
+type walker struct {
+	c   *Client
+	ctx context.Context
+	fn  WalkFunc
+	sem chan struct{} // limits parallel listing, nil when sequential
+}
+
+// listing is a directory listing which may still be in progress
+type listing struct {
+	files Files
+	err   error
+	done  chan struct{}
+}
+
+// walk visits directory or file p, ls is its listing started ahead or nil
+func (w *walker) walk(p string, fi *FileInfo, ls *listing) error {
+	if err := w.fn(p, fi, nil); err != nil || !fi.IsDir {
+		if err == filepath.SkipDir && fi.IsDir {
+			err = nil
+		}
+		return err
+	}
+	if ls == nil {
+		ls = w.list(p)
+	}
+	<-ls.done
+	if ls.err != nil {
+		if err := w.fn(p, fi, ls.err); err != nil {
+			if err == filepath.SkipDir {
+				err = nil
+			}
+			return err
+		}
+		return nil
+	}
+	ahead := make([]*listing, len(ls.files))
+	if w.sem != nil {
+		for i := range ls.files {
+			if ls.files[i].IsDir {
+				ahead[i] = w.list(path.Join(p, ls.files[i].Name))
+			}
+		}
+	}
+	for i := range ls.files {
+		if err := w.walk(path.Join(p, ls.files[i].Name), &ls.files[i], ahead[i]); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// list starts listing directory p, in background when listing is parallel
+func (w *walker) list(p string) *listing {
+	ls := &listing{done: make(chan struct{})}
+	if w.sem == nil {
+		ls.files, ls.err = w.read(p)
+		close(ls.done)
+		return ls
+	}
+	go func() {
+		defer close(ls.done)
+		select {
+		case w.sem <- struct{}{}:
+		case <-w.ctx.Done():
+			ls.err = w.ctx.Err()
+			return
+		}
+		ls.files, ls.err = w.read(p)
+		<-w.sem
+	}()
+	return ls
+}
+
+// read lists directory p sorted and with valid names, without chunks of
+// files uploaded in chunks
+func (w *walker) read(p string) (Files, error) {
+	rc, files, err := w.c.GetContext(w.ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if rc != nil {
+		rc.Close()
+		return nil, fmt.Errorf("%s: not a directory", p)
+	}
+	for i, fi := range files {
+		if fi.Name == "" || fi.Name == "." || fi.Name == ".." || strings.ContainsAny(fi.Name, `/\`) {
+			return nil, fmt.Errorf("%s: invalid file name %q", p, fi.Name)
+		}
+		if fi.Path == "" {
+			files[i].Path = path.Join(p, fi.Name)
+		}
+	}
+	files = hideChunks(files)
+	sort.Sort(files)
+	return files, nil
+}
@@ -0,0 +1,74 @@
+package replica
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	clt, _ := newTestClient(t)
+	src := t.TempDir()
+	writeTree(t, src, testTree)
+	if _, err := clt.UploadTree(src, "public/walk", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		skip map[string]error
+		exp  string
+	}{
+		{"all", nil, "public/walk public/walk/b public/walk/b/d public/walk/b/d/f public/walk/b/d/f/g.txt " +
+			"public/walk/b/d/e.txt public/walk/b/c.txt public/walk/h public/walk/h/j public/walk/h/j/k " +
+			"public/walk/h/j/k/l public/walk/h/j/k/l/m.txt public/walk/h/i.txt public/walk/a.txt"},
+		{"skip dir", map[string]error{"public/walk/b/d": filepath.SkipDir},
+			"public/walk public/walk/b public/walk/b/d public/walk/b/c.txt public/walk/h public/walk/h/j " +
+				"public/walk/h/j/k public/walk/h/j/k/l public/walk/h/j/k/l/m.txt public/walk/h/i.txt public/walk/a.txt"},
+		{"skip all", map[string]error{"public/walk/h": fs.SkipAll},
+			"public/walk public/walk/b public/walk/b/d public/walk/b/d/f public/walk/b/d/f/g.txt " +
+				"public/walk/b/d/e.txt public/walk/b/c.txt public/walk/h"},
+	}
+	for _, parallel := range []int{0, 3} {
+		clt.listing = parallel
+		for _, tt := range tests {
+			var visited []string
+			err := clt.Walk("public/walk", func(p string, fi *FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				visited = append(visited, p)
+				return tt.skip[p]
+			})
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			if got := strings.Join(visited, " "); got != tt.exp {
+				t.Errorf("%s, parallel %d: expected\n%s\ngot\n%s", tt.name, parallel, tt.exp, got)
+			}
+		}
+	}
+
+	var dirs int
+	err := clt.WalkDir("public/walk", func(p string, d fs.DirEntry, err error) error {
+		if d.IsDir() {
+			dirs++
+		}
+		return err
+	})
+	if err != nil || dirs != 8 {
+		t.Errorf("expected 8 directories, got %d, %v", dirs, err)
+	}
+
+	werr := errors.New("stop")
+	err = clt.Walk("public/walk", func(p string, fi *FileInfo, err error) error { return werr })
+	if err != werr {
+		t.Errorf("expected %v, got %v", werr, err)
+	}
+	err = clt.Walk("public/none", func(p string, fi *FileInfo, err error) error { return err })
+	if err == nil {
+		t.Error("expected not found error, got <nil>")
+	}
+}